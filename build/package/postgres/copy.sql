@@ -1,5 +1,6 @@
-\copy brand FROM 'mnt/brand.csv' DELIMITER ';';
+\copy brand (id, brand_name, founding_year, logo_id, brand_owner) FROM 'mnt/brand.csv' DELIMITER ';';
 \copy webUser FROM 'mnt/user.csv' DELIMITER ';';
-\copy item FROM 'mnt/item.csv' DELIMITER ';';
-\copy ordering FROM 'mnt/ordering.csv' WITH DELIMITER ';' NULL AS 'null' csv;
-\copy orderItems FROM 'mnt/orderItems.csv' DELIMITER ';';
+\copy item (id, category, size, price, sex, image_id, brand_id, is_available, stock, title, description) FROM 'mnt/item.csv' DELIMITER ';';
+\copy ordering (id, commit_date, user_id, price, current_status) FROM 'mnt/ordering.csv' WITH DELIMITER ';' NULL AS 'null' csv;
+\copy orderItems (id, order_id, item_id, amount) FROM 'mnt/orderItems.csv' DELIMITER ';';
+update orderItems o set price = i.price, category = i.category, size = i.size, brand_id = i.brand_id, sex = i.sex, image_id = i.image_id from item i, ordering ord where o.item_id = i.id and o.order_id = ord.id and ord.current_status != 'корзина';
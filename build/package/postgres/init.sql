@@ -1,5 +1,6 @@
 -- drop database if exists clothshop;
 -- create database clothshop;
+create extension if not exists pg_trgm;
 create table public.webUser(
   user_id serial not null primary key, 
   user_login text not null unique, user_password text not null, 
@@ -14,7 +15,8 @@ create table public.Brand(
     and founding_year < 2024
   ), 
   logo_id int not null, 
-  brand_owner text not null
+  brand_owner text not null, 
+  archived boolean not null default false
 );
 create table public.Item(
   id serial not null primary key, 
@@ -23,22 +25,156 @@ create table public.Item(
   price int not null check (price > 0), 
   sex text not null, 
   image_id int not null, 
-  brand_id int not null, 
-  is_available boolean
+  brand_id int not null references Brand (id), 
+  is_available boolean, 
+  stock int not null default 0 check (stock >= 0), 
+  reserved int not null default 0 check (reserved >= 0), 
+  check (stock >= reserved), 
+  rating real not null default 0, 
+  review_count int not null default 0, 
+  title text not null default '', 
+  description text not null default '', 
+  search_vector tsvector not null default ''
 );
 create table public.Ordering(
   id serial not null primary key, 
   commit_date date, 
   user_id int not null, 
-  price int check (price > 0), 
-  current_status text not null
+  price int check (price >= 0), 
+  current_status text not null, 
+  refund int not null default 0 check (refund >= 0), 
+  promo_id int, 
+  discount int not null default 0 check (discount >= 0)
 );
 create table public.OrderItems(
   id serial not null primary key, 
   order_id int not null, 
   item_id int not null, 
+  amount int not null check (amount > 0), 
+  price int, 
+  category text, 
+  size text, 
+  brand_id int, 
+  sex text, 
+  image_id int, 
+  held_until timestamp, 
+  seen_price int, 
+  added_price int
+);
+create table public.OrderStatusHistory(
+  id serial not null primary key, 
+  order_id int not null, 
+  status text not null, 
+  changed_by int not null, 
+  changed_at timestamp not null default now(), 
+  comment text not null default ''
+);
+create index on OrderStatusHistory (order_id);
+create table public.GuestBasket(
+  id serial not null primary key, 
+  created_at timestamp not null default now()
+);
+create table public.GuestBasketItems(
+  id serial not null primary key, 
+  basket_id int not null, 
+  item_id int not null, 
+  amount int not null check (amount > 0), 
+  unique (basket_id, item_id)
+);
+create table public.PromoCode(
+  id serial not null primary key, 
+  code text not null unique, 
+  kind text not null check (
+    kind in ('percent', 'fixed')
+  ), 
+  value int not null check (value > 0), 
+  min_total int not null default 0 check (min_total >= 0), 
+  brand_id int, 
+  category text, 
+  expires_at timestamp, 
+  per_user_limit int not null default 1 check (per_user_limit > 0), 
+  is_active boolean not null default true
+);
+create table public.PromoUsage(
+  id serial not null primary key, 
+  promo_id int not null, 
+  user_id int not null, 
+  order_id int not null, 
+  used_at timestamp not null default now()
+);
+create index on PromoUsage (promo_id, user_id);
+create table public.ReturnRequest(
+  id serial not null primary key, 
+  order_id int not null, 
+  user_id int not null, 
+  status text not null, 
+  reason text not null, 
+  refund int not null default 0 check (refund >= 0), 
+  created_at timestamp not null default now(), 
+  decided_by int, 
+  decided_at timestamp, 
+  comment text not null default ''
+);
+create index on ReturnRequest (order_id);
+create index on ReturnRequest (user_id);
+create table public.ReturnItems(
+  id serial not null primary key, 
+  return_id int not null, 
+  order_item_id int not null, 
   amount int not null check (amount > 0)
 );
+create index on ReturnItems (return_id);
+create table public.Review(
+  id serial not null primary key, 
+  item_id int not null, 
+  user_id int not null, 
+  rating int not null check (
+    rating between 1 
+    and 5
+  ), 
+  review_text text not null default '', 
+  status text not null, 
+  created_at timestamp not null default now(), 
+  moderated_by int, 
+  moderated_at timestamp, 
+  moderator_comment text not null default '', 
+  unique (item_id, user_id)
+);
+create index on Review (item_id, status);
+create index on Brand using gin (lower(brand_name) gin_trgm_ops);
+create index on Item using gin (lower(title) gin_trgm_ops);
+create index on Item using gin (search_vector);
+create table public.Wishlist(
+  id serial not null primary key, 
+  user_id int not null, 
+  item_id int not null, 
+  added_at timestamp not null default now(), 
+  unique (user_id, item_id)
+);
+create table public.Image(
+  id serial not null primary key, 
+  content_type text not null, 
+  size int not null check (size > 0), 
+  width int not null, 
+  height int not null, 
+  blob_key text not null unique, 
+  created_at timestamp not null default now()
+);
+create table public.ImageVariant(
+  image_id int not null references Image (id) on delete cascade, 
+  variant text not null, 
+  content_type text not null, 
+  size int not null check (size > 0), 
+  width int not null, 
+  height int not null, 
+  blob_key text not null unique, 
+  unique (image_id, variant)
+);
+create table public.BrandManager(
+  user_id int not null, 
+  brand_id int not null references Brand (id) on delete cascade, 
+  unique (user_id, brand_id)
+);
 set 
   datestyle to 'dmy';
 create user "default_guest";
@@ -65,20 +201,159 @@ select
 grant 
 select 
   on table OrderItems to "default_user";
+grant 
+select 
+  on table OrderStatusHistory to "default_user";
+grant 
+select 
+  on table Wishlist to "default_user";
+grant 
+select 
+  on table Review to "default_guest";
+grant 
+select 
+  on table Review to "default_user";
+grant 
+select 
+  on table Image to "default_guest";
+grant 
+select 
+  on table Image to "default_user";
+grant 
+select 
+  on table ImageVariant to "default_guest";
+grant 
+select 
+  on table ImageVariant to "default_user";
 alter role "default_admin" superuser;
 CREATE 
+OR REPLACE FUNCTION ItemSearchVector(
+  title text, description text, category text, 
+  brand_name text
+) RETURNS tsvector AS $$ 
+select 
+  setweight(
+    to_tsvector('russian', coalesce(title, '')), 
+    'A'
+  ) || setweight(
+    to_tsvector('russian', coalesce(category, '')), 
+    'B'
+  ) || setweight(
+    to_tsvector('russian', coalesce(brand_name, '')), 
+    'B'
+  ) || setweight(
+    to_tsvector('russian', coalesce(description, '')), 
+    'C'
+  ) $$ LANGUAGE sql IMMUTABLE;
+CREATE 
+OR REPLACE FUNCTION RefreshItemSearchVector() RETURNS trigger AS $$ BEGIN 
+new.search_vector := ItemSearchVector(
+  new.title, 
+  new.description, 
+  new.category, 
+  (
+    select 
+      brand_name 
+    from 
+      Brand 
+    where 
+      id = new.brand_id
+  )
+);
+RETURN new;
+END $$ LANGUAGE plpgsql;
+CREATE TRIGGER ItemSearchVector BEFORE INSERT 
+OR 
+UPDATE 
+  OF title, 
+  description, 
+  category, 
+  brand_id ON Item FOR EACH ROW EXECUTE PROCEDURE RefreshItemSearchVector();
+CREATE 
+OR REPLACE FUNCTION RefreshBrandSearchVectors() RETURNS trigger AS $$ BEGIN 
+UPDATE 
+  Item 
+SET 
+  search_vector = ItemSearchVector(
+    title, description, category, new.brand_name
+  ) 
+WHERE 
+  brand_id = new.id;
+RETURN null;
+END $$ LANGUAGE plpgsql;
+CREATE TRIGGER BrandSearchVector 
+AFTER 
+UPDATE 
+  OF brand_name ON Brand FOR EACH ROW WHEN (
+    old.brand_name IS DISTINCT FROM new.brand_name
+  ) EXECUTE PROCEDURE RefreshBrandSearchVectors();
+CREATE 
+OR REPLACE FUNCTION RefreshItemRating(ratedItem int) RETURNS void AS $$ BEGIN 
+UPDATE 
+  Item i 
+SET 
+  rating = coalesce(r.rating, 0), 
+  review_count = coalesce(r.review_count, 0) 
+FROM 
+  (
+    select 
+      avg(rating):: real as rating, 
+      count(*) as review_count 
+    from 
+      Review 
+    where 
+      item_id = ratedItem 
+      and status = 'опубликован'
+  ) r 
+WHERE 
+  i.id = ratedItem;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION BasketHold() RETURNS interval AS $$ 
+select 
+  interval '30 minutes' $$ LANGUAGE sql IMMUTABLE;
+CREATE 
+OR REPLACE FUNCTION TouchUsersBasket(webUser int) RETURNS void AS $$ BEGIN 
+UPDATE 
+  OrderItems o 
+SET 
+  held_until = now() + BasketHold() 
+FROM 
+  Ordering ord 
+WHERE 
+  o.order_id = ord.id 
+  and ord.user_id = webUser 
+  and ord.current_status = 'корзина' 
+  and o.held_until IS NOT NULL;
+END $$ LANGUAGE plpgsql;
+CREATE 
 OR REPLACE FUNCTION AddItemUsersBasket(
   addItem int, webUser int, addAmount int
-) RETURNS boolean AS $$ declare basket_id int;
+) RETURNS int AS $$ declare basket_id int;
 declare orderItem_id int;
-BEGIN IF (
-  select 
-    is_available 
-  from 
-    Item 
-  where 
-    id = addItem
-) != true THEN return false;
+declare orderItemAmount int;
+declare orderItemHeld boolean;
+declare itemAvailable boolean;
+declare itemFree int;
+declare itemPrice int;
+declare toReserve int;
+BEGIN 
+select 
+  i.is_available 
+  and not b.archived, 
+  i.stock - i.reserved, 
+  i.price into itemAvailable, 
+  itemFree, 
+  itemPrice 
+from 
+  Item i 
+  JOIN Brand b ON b.id = i.brand_id 
+where 
+  i.id = addItem for 
+update 
+  of i;
+IF NOT FOUND 
+OR itemAvailable IS NOT true THEN return 1;
 END IF;
 select 
   id into basket_id 
@@ -88,20 +363,34 @@ where
   user_id = webUser 
   and current_status = 'корзина';
 select 
-  id into orderItem_id 
+  id, 
+  amount, 
+  held_until IS NOT NULL into orderItem_id, 
+  orderItemAmount, 
+  orderItemHeld 
 from 
   OrderItems o 
 where 
   o.order_id = basket_id 
   and o.item_id = addItem;
-IF FOUND THEN 
+toReserve := addAmount;
+IF orderItem_id IS NOT NULL 
+AND NOT orderItemHeld THEN toReserve := addAmount + orderItemAmount;
+END IF;
+IF itemFree < toReserve THEN return 2;
+END IF;
+IF orderItem_id IS NOT NULL THEN 
 UPDATE 
   OrderItems 
 SET 
-  amount = amount + addAmount 
+  amount = amount + addAmount, 
+  held_until = now() + BasketHold() 
 WHERE 
   id = orderItem_id;
-ELSE INSERT INTO OrderItems 
+ELSE INSERT INTO OrderItems (
+  id, order_id, item_id, amount, added_price, 
+  seen_price, held_until
+) 
 VALUES 
   (
     (
@@ -112,10 +401,20 @@ VALUES
     ) + 1, 
     basket_id, 
     addItem, 
-    addAmount
+    addAmount, 
+    itemPrice, 
+    itemPrice, 
+    now() + BasketHold()
   );
 END IF;
-return true;
+UPDATE 
+  Item 
+SET 
+  reserved = reserved + toReserve 
+WHERE 
+  id = addItem;
+PERFORM TouchUsersBasket(webUser);
+return 0;
 END $$ LANGUAGE plpgsql;
 CREATE 
 OR REPLACE FUNCTION DecItemUsersBasket(
@@ -123,6 +422,7 @@ OR REPLACE FUNCTION DecItemUsersBasket(
 ) RETURNS boolean AS $$ declare basket_id int;
 declare orderItem_id int;
 declare orderItemAmount int;
+declare orderItemHeld boolean;
 BEGIN 
 select 
   id into basket_id 
@@ -131,16 +431,26 @@ from
 where 
   user_id = webUser 
   and current_status = 'корзина';
+PERFORM 
+  id 
+FROM 
+  Item 
+WHERE 
+  id = decItem for 
+UPDATE;
 select 
   id, 
-  amount into orderItem_id, 
-  orderItemAmount 
+  amount, 
+  held_until IS NOT NULL into orderItem_id, 
+  orderItemAmount, 
+  orderItemHeld 
 from 
   OrderItems o 
 where 
   o.order_id = basket_id 
   and o.item_id = decItem;
-IF orderItemAmount < decAmount THEN return false;
+IF orderItem_id IS NULL 
+OR orderItemAmount < decAmount THEN return false;
 ELSIF orderItemAmount > decAmount THEN 
 UPDATE 
   OrderItems 
@@ -154,13 +464,118 @@ DELETE FROM
 WHERE 
   id = orderItem_id;
 END IF;
+IF orderItemHeld THEN 
+UPDATE 
+  Item 
+SET 
+  reserved = greatest(reserved - decAmount, 0) 
+WHERE 
+  id = decItem;
+END IF;
+PERFORM TouchUsersBasket(webUser);
 return true;
 END $$ LANGUAGE plpgsql;
 CREATE 
+OR REPLACE FUNCTION MarkUsersBasketSeen(webUser int) RETURNS void AS $$ BEGIN 
+UPDATE 
+  OrderItems o 
+SET 
+  seen_price = i.price 
+FROM 
+  Item i, 
+  Ordering ord 
+WHERE 
+  o.item_id = i.id 
+  and o.order_id = ord.id 
+  and ord.user_id = webUser 
+  and ord.current_status = 'корзина';
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION ReleaseExpiredHolds() RETURNS int AS $$ declare released int;
+BEGIN 
+PERFORM 
+  i.id 
+FROM 
+  Item i 
+WHERE 
+  i.id IN (
+    select 
+      o.item_id 
+    from 
+      OrderItems o 
+      JOIN Ordering ord ON o.order_id = ord.id 
+    where 
+      ord.current_status = 'корзина' 
+      and o.held_until < now()
+  ) 
+ORDER BY 
+  i.id for 
+UPDATE;
+WITH expired AS (
+  UPDATE 
+    OrderItems o 
+  SET 
+    held_until = NULL 
+  FROM 
+    Ordering ord 
+  WHERE 
+    o.order_id = ord.id 
+    and ord.current_status = 'корзина' 
+    and o.held_until < now() RETURNING o.item_id, 
+    o.amount
+), 
+per_item AS (
+  select 
+    item_id, 
+    sum(amount) as amount 
+  from 
+    expired 
+  group by 
+    item_id
+) 
+UPDATE 
+  Item i 
+SET 
+  reserved = greatest(i.reserved - p.amount, 0) 
+FROM 
+  per_item p 
+WHERE 
+  p.item_id = i.id;
+GET DIAGNOSTICS released = ROW_COUNT;
+return released;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION SetItemUsersBasket(
+  setItem int, webUser int, setAmount int
+) RETURNS int AS $$ declare currentAmount int;
+BEGIN 
+select 
+  coalesce(
+    sum(o.amount), 
+    0
+  ) into currentAmount 
+from 
+  OrderItems o 
+  JOIN Ordering ord ON o.order_id = ord.id 
+where 
+  ord.user_id = webUser 
+  and ord.current_status = 'корзина' 
+  and o.item_id = setItem;
+IF setAmount > currentAmount THEN return AddItemUsersBasket(
+  setItem, webUser, setAmount - currentAmount
+);
+ELSIF setAmount < currentAmount THEN PERFORM DecItemUsersBasket(
+  setItem, webUser, currentAmount - setAmount
+);
+END IF;
+return 0;
+END $$ LANGUAGE plpgsql;
+CREATE 
 OR REPLACE FUNCTION ItemsInUsersBasket(webUser int) RETURNS TABLE (
   id int, category text, size text, price int, 
   sex text, image_id int, brand_id int, 
-  is_available boolean, amount int
+  is_available boolean, amount int, hold_left int, 
+  added_price int
 ) AS $$ declare basket_id int;
 BEGIN 
 select 
@@ -179,11 +594,22 @@ SELECT
   i.sex, 
   i.image_id, 
   i.brand_id, 
-  i.is_available, 
-  o.amount 
+  i.is_available 
+  and not b.archived, 
+  o.amount, 
+  greatest(
+    extract(
+      epoch 
+      from 
+        o.held_until - now()
+    ), 
+    0
+  ):: int, 
+  o.added_price 
 FROM 
   OrderItems o 
   JOIN Item i ON o.item_id = i.id 
+  JOIN Brand b ON b.id = i.brand_id 
 where 
   o.order_id = basket_id;
 END $$ LANGUAGE plpgsql;
@@ -204,7 +630,245 @@ END IF;
 return 0;
 END $$ LANGUAGE plpgsql;
 CREATE 
-OR REPLACE FUNCTION CommitOrder(webUser int) RETURNS int AS $$ declare basket_id int;
+OR REPLACE FUNCTION AddItemGuestBasket(
+  addItem int, guestBasket int, addAmount int
+) RETURNS int AS $$ declare itemAvailable boolean;
+declare itemFree int;
+declare inBasket int;
+BEGIN IF NOT exists (
+  select 
+    * 
+  from 
+    GuestBasket 
+  where 
+    id = guestBasket
+) THEN return 3;
+END IF;
+select 
+  i.is_available 
+  and not b.archived, 
+  i.stock - i.reserved into itemAvailable, 
+  itemFree 
+from 
+  Item i 
+  JOIN Brand b ON b.id = i.brand_id 
+where 
+  i.id = addItem;
+IF NOT FOUND 
+OR itemAvailable IS NOT true THEN return 1;
+END IF;
+select 
+  coalesce(
+    sum(amount), 
+    0
+  ) into inBasket 
+from 
+  GuestBasketItems 
+where 
+  basket_id = guestBasket 
+  and item_id = addItem;
+IF itemFree < inBasket + addAmount THEN return 2;
+END IF;
+INSERT INTO GuestBasketItems (basket_id, item_id, amount) 
+VALUES 
+  (guestBasket, addItem, addAmount) ON CONFLICT (basket_id, item_id) DO 
+UPDATE 
+SET 
+  amount = GuestBasketItems.amount + excluded.amount;
+return 0;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION DecItemGuestBasket(
+  decItem int, guestBasket int, decAmount int
+) RETURNS boolean AS $$ declare inBasket int;
+BEGIN 
+select 
+  amount into inBasket 
+from 
+  GuestBasketItems 
+where 
+  basket_id = guestBasket 
+  and item_id = decItem;
+IF inBasket IS NULL 
+OR inBasket < decAmount THEN return false;
+ELSIF inBasket > decAmount THEN 
+UPDATE 
+  GuestBasketItems 
+SET 
+  amount = amount - decAmount 
+WHERE 
+  basket_id = guestBasket 
+  and item_id = decItem;
+ELSE 
+DELETE FROM 
+  GuestBasketItems 
+WHERE 
+  basket_id = guestBasket 
+  and item_id = decItem;
+END IF;
+return true;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION ItemsInGuestBasket(guestBasket int) RETURNS TABLE (
+  id int, category text, size text, price int, 
+  sex text, image_id int, brand_id int, 
+  is_available boolean, amount int
+) AS $$ BEGIN return query 
+SELECT 
+  i.id, 
+  i.category, 
+  i.size, 
+  i.price, 
+  i.sex, 
+  i.image_id, 
+  i.brand_id, 
+  i.is_available 
+  and not b.archived, 
+  g.amount 
+FROM 
+  GuestBasketItems g 
+  JOIN Item i ON g.item_id = i.id 
+  JOIN Brand b ON b.id = i.brand_id 
+where 
+  g.basket_id = guestBasket;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION MergeGuestBasket(guestBasket int, webUser int) RETURNS int AS $$ declare line record;
+declare merged int := 0;
+BEGIN FOR line IN 
+select 
+  item_id, 
+  amount 
+from 
+  GuestBasketItems 
+where 
+  basket_id = guestBasket 
+order by 
+  id LOOP IF AddItemUsersBasket(line.item_id, webUser, line.amount) = 0 THEN merged := merged + 1;
+END IF;
+END LOOP;
+DELETE FROM 
+  GuestBasketItems 
+WHERE 
+  basket_id = guestBasket;
+DELETE FROM 
+  GuestBasket 
+WHERE 
+  id = guestBasket;
+return merged;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION CheckPromo(webUser int, promo int) RETURNS int AS $$ declare p PromoCode%ROWTYPE;
+declare used int;
+declare eligible int;
+BEGIN 
+select 
+  * into p 
+from 
+  PromoCode 
+where 
+  id = promo;
+IF NOT FOUND 
+OR p.is_active IS NOT true THEN return 1;
+END IF;
+IF p.expires_at IS NOT NULL 
+AND p.expires_at < now() THEN return 2;
+END IF;
+select 
+  count(*) into used 
+from 
+  PromoUsage 
+where 
+  promo_id = promo 
+  and user_id = webUser;
+IF used >= p.per_user_limit THEN return 3;
+END IF;
+IF UserBasketPrice(webUser) < p.min_total THEN return 4;
+END IF;
+select 
+  coalesce(
+    sum(b.price * b.amount), 
+    0
+  ) into eligible 
+from 
+  ItemsInUsersBasket(webUser) b 
+where 
+  (
+    p.brand_id IS NULL 
+    or b.brand_id = p.brand_id
+  ) 
+  and (
+    p.category IS NULL 
+    or b.category = p.category
+  );
+IF eligible = 0 THEN return 5;
+END IF;
+return 0;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION BasketDiscount(webUser int) RETURNS int AS $$ declare p PromoCode%ROWTYPE;
+declare eligible int;
+BEGIN 
+select 
+  pc.* into p 
+from 
+  Ordering o 
+  JOIN PromoCode pc ON o.promo_id = pc.id 
+where 
+  o.user_id = webUser 
+  and o.current_status = 'корзина';
+IF NOT FOUND 
+OR CheckPromo(webUser, p.id) != 0 THEN return 0;
+END IF;
+select 
+  coalesce(
+    sum(b.price * b.amount), 
+    0
+  ) into eligible 
+from 
+  ItemsInUsersBasket(webUser) b 
+where 
+  (
+    p.brand_id IS NULL 
+    or b.brand_id = p.brand_id
+  ) 
+  and (
+    p.category IS NULL 
+    or b.category = p.category
+  );
+IF p.kind = 'percent' THEN return eligible * p.value / 100;
+END IF;
+return least(p.value, eligible);
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION ApplyPromo(webUser int, promoCode text) RETURNS int AS $$ declare promo int;
+declare res int;
+BEGIN 
+select 
+  id into promo 
+from 
+  PromoCode 
+where 
+  code = promoCode;
+IF NOT FOUND THEN return 1;
+END IF;
+res := CheckPromo(webUser, promo);
+IF res != 0 THEN return res;
+END IF;
+UPDATE 
+  Ordering 
+SET 
+  promo_id = promo 
+WHERE 
+  user_id = webUser 
+  and current_status = 'корзина';
+return 0;
+END $$ LANGUAGE plpgsql;
+CREATE 
+OR REPLACE FUNCTION CommitOrder(
+  webUser int, confirmPrices boolean
+) RETURNS int AS $$ declare basket_id int;
+declare basket_discount int;
 BEGIN IF NOT exists (
   select 
     * 
@@ -234,6 +898,86 @@ from
 where 
   o.user_id = webUser 
   and current_status = 'корзина';
+PERFORM 
+  i.id 
+FROM 
+  Item i 
+WHERE 
+  i.id IN (
+    select 
+      o.item_id 
+    from 
+      OrderItems o 
+    where 
+      o.order_id = basket_id
+  ) 
+ORDER BY 
+  i.id for 
+UPDATE;
+IF exists (
+  select 
+    * 
+  from 
+    OrderItems o 
+    JOIN Item i ON o.item_id = i.id 
+  where 
+    o.order_id = basket_id 
+    and i.stock - CASE WHEN o.held_until IS NULL THEN i.reserved ELSE 0 END < o.amount
+) THEN return (
+  select 
+    3
+);
+END IF;
+IF NOT confirmPrices 
+AND exists (
+  select 
+    * 
+  from 
+    OrderItems o 
+    JOIN Item i ON o.item_id = i.id 
+  where 
+    o.order_id = basket_id 
+    and o.seen_price IS NOT NULL 
+    and o.seen_price <> i.price
+) THEN return (
+  select 
+    4
+);
+END IF;
+UPDATE 
+  Item i 
+SET 
+  stock = i.stock - o.amount, 
+  reserved = greatest(
+    i.reserved - CASE WHEN o.held_until IS NULL THEN 0 ELSE o.amount END, 
+    0
+  ) 
+FROM 
+  OrderItems o 
+WHERE 
+  o.item_id = i.id 
+  and o.order_id = basket_id;
+UPDATE 
+  OrderItems 
+SET 
+  held_until = NULL 
+WHERE 
+  order_id = basket_id;
+UPDATE 
+  OrderItems o 
+SET 
+  price = i.price, 
+  category = i.category, 
+  size = i.size, 
+  brand_id = i.brand_id, 
+  sex = i.sex, 
+  image_id = i.image_id 
+FROM 
+  Item i 
+WHERE 
+  o.item_id = i.id 
+  and o.order_id = basket_id;
+basket_discount := BasketDiscount(webUser);
 UPDATE 
   Ordering 
 SET 
@@ -244,10 +988,25 @@ SET
   price = (
     select 
       UserBasketPrice(webUser)
-  ), 
+  ) - basket_discount, 
+  discount = basket_discount, 
+  promo_id = CASE WHEN basket_discount > 0 THEN promo_id ELSE NULL END, 
   current_status = 'оформлен' 
 WHERE 
   id = basket_id;
+IF basket_discount > 0 THEN INSERT INTO PromoUsage (promo_id, user_id, order_id) 
+select 
+  promo_id, 
+  webUser, 
+  basket_id 
+from 
+  Ordering 
+where 
+  id = basket_id;
+END IF;
+INSERT INTO OrderStatusHistory (order_id, status, changed_by) 
+VALUES 
+  (basket_id, 'оформлен', webUser);
 INSERT INTO Ordering (id, user_id, current_status) 
 VALUES 
   (
@@ -266,7 +1025,6 @@ return (
 );
 END $$ LANGUAGE plpgsql;
 
-
 CREATE OR REPLACE FUNCTION NewUser(
   user_login text, user_password text, user_name text, user_sex text, user_role text
 ) RETURNS int AS $$ declare cr_id int;
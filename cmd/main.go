@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	basketDel "github.com/el1ljah/cp_db/internal/basket/delivery"
 	basketRepo "github.com/el1ljah/cp_db/internal/basket/repo"
@@ -10,15 +11,34 @@ import (
 	brandDel "github.com/el1ljah/cp_db/internal/brand/delivery"
 	brandRepo "github.com/el1ljah/cp_db/internal/brand/repo"
 	brandServ "github.com/el1ljah/cp_db/internal/brand/service"
+	imageDel "github.com/el1ljah/cp_db/internal/image/delivery"
+	imageRepo "github.com/el1ljah/cp_db/internal/image/repo"
+	imageServ "github.com/el1ljah/cp_db/internal/image/service"
 	itemDel "github.com/el1ljah/cp_db/internal/item/delivery"
 	itemRepo "github.com/el1ljah/cp_db/internal/item/repo"
 	itemServ "github.com/el1ljah/cp_db/internal/item/service"
 	orderDel "github.com/el1ljah/cp_db/internal/order/delivery"
 	orderRepo "github.com/el1ljah/cp_db/internal/order/repo"
 	orderServ "github.com/el1ljah/cp_db/internal/order/service"
+	promoDel "github.com/el1ljah/cp_db/internal/promo/delivery"
+	promoRepo "github.com/el1ljah/cp_db/internal/promo/repo"
+	promoServ "github.com/el1ljah/cp_db/internal/promo/service"
+	returnsDel "github.com/el1ljah/cp_db/internal/returns/delivery"
+	returnsRepo "github.com/el1ljah/cp_db/internal/returns/repo"
+	returnsServ "github.com/el1ljah/cp_db/internal/returns/service"
+	reviewDel "github.com/el1ljah/cp_db/internal/review/delivery"
+	reviewRepo "github.com/el1ljah/cp_db/internal/review/repo"
+	reviewServ "github.com/el1ljah/cp_db/internal/review/service"
+	searchDel "github.com/el1ljah/cp_db/internal/search/delivery"
+	searchRepo "github.com/el1ljah/cp_db/internal/search/repo"
+	searchServ "github.com/el1ljah/cp_db/internal/search/service"
 	userDel "github.com/el1ljah/cp_db/internal/user/delivery"
 	userRepo "github.com/el1ljah/cp_db/internal/user/repo"
 	userServ "github.com/el1ljah/cp_db/internal/user/service"
+	wishlistDel "github.com/el1ljah/cp_db/internal/wishlist/delivery"
+	wishlistRepo "github.com/el1ljah/cp_db/internal/wishlist/repo"
+	wishlistServ "github.com/el1ljah/cp_db/internal/wishlist/service"
+	"github.com/el1ljah/cp_db/pkg/blobstore"
 	"github.com/el1ljah/cp_db/pkg/context"
 	"github.com/el1ljah/cp_db/pkg/middleware"
 	"github.com/el1ljah/cp_db/pkg/session"
@@ -30,7 +50,11 @@ import (
 	"go.uber.org/zap"
 )
 
-const port = ":8080"
+const (
+	port            = ":8080"
+	holdSweepPeriod = time.Minute
+	imagesDir       = "data/images"
+)
 
 // @title           Clothes store 👚
 // @version         1.337
@@ -49,6 +73,13 @@ const port = ":8080"
 // @tag.name items
 // @tag.name brands
 // @tag.name basket
+// @tag.name orders
+// @tag.name returns
+// @tag.name promos
+// @tag.name wishlist
+// @tag.name reviews
+// @tag.name search
+// @tag.name images
 func main() {
 	zapLogger := zap.Must(zap.NewDevelopment())
 	logger := zapLogger.Sugar()
@@ -69,9 +100,28 @@ func main() {
 		ContextManager: contextManager,
 	}
 
+	guestManager := middleware.GuestManager{
+		SessionManager: sessionManager,
+		Logger:         logger,
+		ContextManager: contextManager,
+	}
+
+	basketService := basketServ.BasketService{
+		BasketRepo: &basketRepo.PgBasketRepo{
+			Logger: logger,
+			DB:     db,
+		},
+		Logger: logger,
+	}
+
+	stopSweeper := make(chan struct{})
+	defer close(stopSweeper)
+	go basketService.RunHoldSweeper(holdSweepPeriod, stopSweeper)
+
 	userHandler := userDel.UserHandler{
 		Logger:   logger,
 		Sessions: sessionManager,
+		Baskets:  basketService,
 		UserService: userServ.UserService{
 			UserRepo: &userRepo.PgUserRepo{
 				Logger: logger,
@@ -81,24 +131,40 @@ func main() {
 		},
 	}
 
-	brandHandler := brandDel.BrandHandler{
+	imageService := imageServ.ImageService{
+		ImageRepo: &imageRepo.PgImageRepo{
+			Logger: logger,
+			DB:     db,
+		},
+		Store:  blobstore.LocalStore{Dir: imagesDir},
 		Logger: logger,
-		BrandService: brandServ.BrandService{
-			BrandRepo: &brandRepo.PgBrandRepo{
-				Logger: logger,
-				DB:     db,
-			},
+	}
+
+	brandService := brandServ.BrandService{
+		BrandRepo: &brandRepo.PgBrandRepo{
 			Logger: logger,
+			DB:     db,
 		},
+		Images: imageService,
+		Logger: logger,
+	}
+
+	brandHandler := brandDel.BrandHandler{
+		ContextManager: &contextManager,
+		Logger:         logger,
+		BrandService:   brandService,
 	}
 
 	itemHandler := itemDel.ItemHandler{
-		Logger: logger,
+		ContextManager: &contextManager,
+		Logger:         logger,
 		ItemService: itemServ.ItemService{
 			ItemRepo: &itemRepo.PgItemRepo{
 				Logger: logger,
 				DB:     db,
 			},
+			Brands: brandService,
+			Images: imageService,
 			Logger: logger,
 		},
 	}
@@ -106,20 +172,39 @@ func main() {
 	basketHandler := basketDel.BasketHandler{
 		ContextManager: &contextManager,
 		Logger:         logger,
-		BasketService: basketServ.BasketService{
-			BasketRepo: &basketRepo.PgBasketRepo{
+		BasketService:  basketService,
+		Sessions:       sessionManager,
+	}
+
+	orderHandler := orderDel.OrderHandler{
+		ContextManager: &contextManager,
+		Logger:         logger,
+		OrderService: orderServ.OrderService{
+			OrderRepo: &orderRepo.PgOrderRepo{
 				Logger: logger,
 				DB:     db,
 			},
+			Brands: brandService,
 			Logger: logger,
 		},
 	}
 
-	orderHandler := orderDel.OrderHandler{
+	returnHandler := returnsDel.ReturnHandler{
 		ContextManager: &contextManager,
 		Logger:         logger,
-		OrderService: orderServ.OrderService{
-			OrderRepo: &orderRepo.PgOrderRepo{
+		ReturnService: returnsServ.ReturnService{
+			ReturnRepo: &returnsRepo.PgReturnRepo{
+				Logger: logger,
+				DB:     db,
+			},
+			Logger: logger,
+		},
+	}
+
+	promoHandler := promoDel.PromoHandler{
+		Logger: logger,
+		PromoService: promoServ.PromoService{
+			PromoRepo: &promoRepo.PgPromoRepo{
 				Logger: logger,
 				DB:     db,
 			},
@@ -127,6 +212,46 @@ func main() {
 		},
 	}
 
+	wishlistHandler := wishlistDel.WishlistHandler{
+		Logger:         logger,
+		ContextManager: &contextManager,
+		WishlistService: wishlistServ.WishlistService{
+			WishlistRepo: &wishlistRepo.PgWishlistRepo{
+				Logger: logger,
+				DB:     db,
+			},
+			Logger: logger,
+		},
+	}
+
+	reviewHandler := reviewDel.ReviewHandler{
+		Logger:         logger,
+		ContextManager: &contextManager,
+		ReviewService: reviewServ.ReviewService{
+			ReviewRepo: &reviewRepo.PgReviewRepo{
+				Logger: logger,
+				DB:     db,
+			},
+			Logger: logger,
+		},
+	}
+
+	searchHandler := searchDel.SearchHandler{
+		Logger: logger,
+		SearchService: searchServ.SearchService{
+			SearchRepo: &searchRepo.PgSearchRepo{
+				Logger: logger,
+				DB:     db,
+			},
+			Logger: logger,
+		},
+	}
+
+	imageHandler := imageDel.ImageHandler{
+		Logger:       logger,
+		ImageService: imageService,
+	}
+
 	r := mux.NewRouter()
 
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
@@ -134,27 +259,69 @@ func main() {
 	r.HandleFunc("/register", userHandler.Register).Methods("POST")
 	r.HandleFunc("/login", userHandler.Login).Methods("POST")
 
+	r.HandleFunc("/brands", http.HandlerFunc(brandHandler.GetAll)).Methods("GET")
 	r.HandleFunc("/brands/{BRAND_ID:[0-9]+}", http.HandlerFunc(brandHandler.Get)).Methods("GET")
 	r.Handle("/brands", authManager.Auth(http.HandlerFunc(brandHandler.Create), "admin")).Methods("PUT")
-	r.Handle("/brands/{BRAND_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(brandHandler.Update), "admin")).Methods("POST")
+	r.Handle("/brands/{BRAND_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(brandHandler.Update), "admin", "brand_manager")).Methods("POST")
 	r.Handle("/brands/{BRAND_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(brandHandler.Delete), "admin")).Methods("DELETE")
+	r.Handle("/brands/{BRAND_ID:[0-9]+}/managers/{USER_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(brandHandler.AddManager), "admin")).Methods("PUT")
+	r.Handle("/brands/{BRAND_ID:[0-9]+}/managers/{USER_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(brandHandler.RemoveManager), "admin")).Methods("DELETE")
 
 	r.HandleFunc("/items/{ITEM_ID:[0-9]+}", http.HandlerFunc(itemHandler.Get)).Methods("GET")
-	r.Handle("/items", authManager.Auth(http.HandlerFunc(itemHandler.Create), "admin")).Methods("PUT")
-	r.Handle("/items/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(itemHandler.Update), "admin")).Methods("POST")
-	r.Handle("/items/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(itemHandler.Patch), "admin")).Methods("PATCH")
-	r.Handle("/items/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(itemHandler.Delete), "admin")).Methods("DELETE")
+	r.Handle("/items", authManager.Auth(http.HandlerFunc(itemHandler.Create), "admin", "brand_manager")).Methods("PUT")
+	r.Handle("/items/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(itemHandler.Update), "admin", "brand_manager")).Methods("POST")
+	r.Handle("/items/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(itemHandler.Patch), "admin", "brand_manager")).Methods("PATCH")
+	r.Handle("/items/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(itemHandler.Delete), "admin", "brand_manager")).Methods("DELETE")
+	r.Handle("/items/{ITEM_ID:[0-9]+}/stock", authManager.Auth(http.HandlerFunc(itemHandler.PatchStock), "admin")).Methods("PATCH")
 	r.HandleFunc("/items", http.HandlerFunc(itemHandler.GetAll)).Methods("GET")
+	r.HandleFunc("/items/facets", http.HandlerFunc(itemHandler.GetFacets)).Methods("GET")
+
+	r.Handle("/basket", authManager.Auth(http.HandlerFunc(basketHandler.Get), "user", "brand_manager", "admin")).Methods("GET")
+	r.Handle("/basket/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(basketHandler.AddItem), "user", "brand_manager", "admin")).Methods("POST")
+	r.Handle("/basket/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(basketHandler.DecItem), "user", "brand_manager", "admin")).Methods("DELETE")
+	r.Handle("/basket/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(basketHandler.SetItem), "user", "brand_manager", "admin")).Methods("PUT")
+	r.Handle("/basket", authManager.Auth(http.HandlerFunc(basketHandler.SetItems), "user", "brand_manager", "admin")).Methods("PUT")
+	r.Handle("/basket/promo", authManager.Auth(http.HandlerFunc(basketHandler.ApplyPromo), "user", "brand_manager", "admin")).Methods("POST")
+	r.Handle("/basket/promo", authManager.Auth(http.HandlerFunc(basketHandler.RemovePromo), "user", "brand_manager", "admin")).Methods("DELETE")
+
+	r.HandleFunc("/guest/basket", http.HandlerFunc(basketHandler.CreateGuest)).Methods("POST")
+	r.Handle("/guest/basket", guestManager.Guest(http.HandlerFunc(basketHandler.GetGuest))).Methods("GET")
+	r.Handle("/guest/basket/{ITEM_ID:[0-9]+}", guestManager.Guest(http.HandlerFunc(basketHandler.AddGuestItem))).Methods("POST")
+	r.Handle("/guest/basket/{ITEM_ID:[0-9]+}", guestManager.Guest(http.HandlerFunc(basketHandler.DecGuestItem))).Methods("DELETE")
 
-	r.Handle("/basket", authManager.Auth(http.HandlerFunc(basketHandler.Get), "user", "admin")).Methods("GET")
-	r.Handle("/basket/{ITEM_ID}", authManager.Auth(http.HandlerFunc(basketHandler.AddItem), "user", "admin")).Methods("POST")
-	r.Handle("/basket/{ITEM_ID}", authManager.Auth(http.HandlerFunc(basketHandler.DecItem), "user", "admin")).Methods("DELETE")
+	r.Handle("/promos", authManager.Auth(http.HandlerFunc(promoHandler.Create), "admin")).Methods("PUT")
+	r.Handle("/promos", authManager.Auth(http.HandlerFunc(promoHandler.GetAll), "admin")).Methods("GET")
+	r.Handle("/promos/{PROMO_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(promoHandler.Delete), "admin")).Methods("DELETE")
 
-	r.Handle("/orders", authManager.Auth(http.HandlerFunc(orderHandler.Commit), "user", "admin")).Methods("POST")
+	r.HandleFunc("/search/suggest", http.HandlerFunc(searchHandler.Suggest)).Methods("GET")
+
+	r.Handle("/images", authManager.Auth(http.HandlerFunc(imageHandler.Upload), "admin")).Methods("POST")
+	r.HandleFunc("/images/{IMAGE_ID:[0-9]+}", http.HandlerFunc(imageHandler.Get)).Methods("GET")
+
+	r.HandleFunc("/items/{ITEM_ID:[0-9]+}/reviews", http.HandlerFunc(reviewHandler.GetItemsAll)).Methods("GET")
+	r.Handle("/items/{ITEM_ID:[0-9]+}/reviews", authManager.Auth(http.HandlerFunc(reviewHandler.Create), "user", "brand_manager", "admin")).Methods("POST")
+	r.Handle("/reviews", authManager.Auth(http.HandlerFunc(reviewHandler.GetAll), "admin")).Methods("GET")
+	r.Handle("/reviews/{REVIEW_ID:[0-9]+}/moderation", authManager.Auth(http.HandlerFunc(reviewHandler.Moderate), "admin")).Methods("POST")
+
+	r.Handle("/wishlist", authManager.Auth(http.HandlerFunc(wishlistHandler.Get), "user", "brand_manager", "admin")).Methods("GET")
+	r.Handle("/wishlist/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(wishlistHandler.Add), "user", "brand_manager", "admin")).Methods("POST")
+	r.Handle("/wishlist/{ITEM_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(wishlistHandler.Remove), "user", "brand_manager", "admin")).Methods("DELETE")
+	r.Handle("/wishlist/{ITEM_ID:[0-9]+}/basket", authManager.Auth(http.HandlerFunc(wishlistHandler.MoveToBasket), "user", "brand_manager", "admin")).Methods("POST")
+
+	r.Handle("/orders", authManager.Auth(http.HandlerFunc(orderHandler.Commit), "user", "brand_manager", "admin")).Methods("POST")
 	r.Handle("/orders/{ORDER_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(orderHandler.Get), "admin")).Methods("GET")
-	r.Handle("/orders/{ORDER_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(orderHandler.Update), "admin")).Methods("POST")
-	//r.Handle("/orders/my", authManager.Auth(http.HandlerFunc(orderHandler.GetAllMy), "user", "admin")).Methods("GET")
+	r.Handle("/orders/{ORDER_ID:[0-9]+}/history", authManager.Auth(http.HandlerFunc(orderHandler.GetHistory), "admin")).Methods("GET")
+	r.Handle("/orders/{ORDER_ID:[0-9]+}/status", authManager.Auth(http.HandlerFunc(orderHandler.UpdateStatus), "admin")).Methods("POST")
+	r.Handle("/orders/{ORDER_ID:[0-9]+}/cancel", authManager.Auth(http.HandlerFunc(orderHandler.Cancel), "user", "brand_manager", "admin")).Methods("POST")
+	r.Handle("/orders/my", authManager.Auth(http.HandlerFunc(orderHandler.GetAllMy), "user", "brand_manager", "admin")).Methods("GET")
 	r.Handle("/orders", authManager.Auth(http.HandlerFunc(orderHandler.GetAll), "admin")).Methods("GET")
+	r.Handle("/reports/sales", authManager.Auth(http.HandlerFunc(orderHandler.SalesReport), "admin", "brand_manager")).Methods("GET")
+
+	r.Handle("/orders/{ORDER_ID:[0-9]+}/returns", authManager.Auth(http.HandlerFunc(returnHandler.Create), "user", "brand_manager", "admin")).Methods("POST")
+	r.Handle("/returns/my", authManager.Auth(http.HandlerFunc(returnHandler.GetAllMy), "user", "brand_manager", "admin")).Methods("GET")
+	r.Handle("/returns/{RETURN_ID:[0-9]+}", authManager.Auth(http.HandlerFunc(returnHandler.Get), "user", "brand_manager", "admin")).Methods("GET")
+	r.Handle("/returns/{RETURN_ID:[0-9]+}/decision", authManager.Auth(http.HandlerFunc(returnHandler.Decide), "admin")).Methods("POST")
+	r.Handle("/returns", authManager.Auth(http.HandlerFunc(returnHandler.GetAll), "admin")).Methods("GET")
 
 
 	mux := middleware.AccessLog(logger, r)
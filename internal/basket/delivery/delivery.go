@@ -3,29 +3,50 @@ package delivery
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
 
+	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
 type BasketService interface {
 	Get(int) (models.Basket, error)
 	AddItem(int, int) error
 	DecItem(int, int) error
+	SetItem(int, int, models.BasketLine) (models.Basket, error)
+	SetItems(int, []models.BasketLine) (models.Basket, error)
+	ApplyPromo(int, models.PromoApply) (models.Basket, error)
+	RemovePromo(int) (models.Basket, error)
+	CreateGuest() (int, error)
+	GetGuest(int) (models.Basket, error)
+	AddGuestItem(int, int) error
+	DecGuestItem(int, int) error
 }
 
 type ContextManager interface {
 	UserIDFromContext(ctx context.Context) (int, error)
+	GuestBasketIDFromContext(ctx context.Context) (int, error)
+}
+
+type GuestSessionManager interface {
+	CreateGuestSession(int) (string, error)
+}
+
+type GuestTokenForm struct {
+	Token string `json:"token"`
 }
 
 type BasketHandler struct {
 	BasketService  BasketService
 	Logger         logger.Logger
 	ContextManager ContextManager
+	Sessions       GuestSessionManager
 }
 
 // @Summary      Get all items in basket
@@ -84,6 +105,7 @@ func (bh *BasketHandler) Get(w http.ResponseWriter, r *http.Request) {
 // @Success      200  
 // @Failure      401  
 // @Failure      404  
+// @Failure      409  
 // @Failure      500  
 // @Security ApiKeyAuth
 // @Router       /basket/{ITEM_ID} [post]
@@ -113,6 +135,12 @@ func (bh *BasketHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = bh.BasketService.AddItem(itemId, userID)
+	if errors.Is(err, models.ErrOutOfStock) {
+		bh.Logger.Infow("can`t add item to basket (not enough items in stock)",
+			"err:", err.Error())
+		http.Error(w, "can`t add item to basket (not enough items in stock)", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		bh.Logger.Infow("can`t add item to basket (item is not available)",
 			"err:", err.Error())
@@ -185,3 +213,524 @@ func (bh *BasketHandler) DecItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// @Summary      Set amount of item in basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "ID of item"
+// @Param 		 line body models.BasketLine true "new amount, 0 removes item"
+// @Success      200  {object}  models.Basket
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /basket/{ITEM_ID} [put]
+func (bh *BasketHandler) SetItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemIdString, ok := vars["ITEM_ID"]
+	if !ok {
+		bh.Logger.Errorw("no ITEM_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	itemId, err := strconv.Atoi(itemIdString)
+	if err != nil {
+		bh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	line := &models.BasketLine{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		bh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, line)
+	if err != nil {
+		bh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(line)
+	if err != nil {
+		bh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := bh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basket, err := bh.BasketService.SetItem(itemId, userID, *line)
+	if errors.Is(err, models.ErrOutOfStock) {
+		bh.Logger.Infow("can`t set item in basket (not enough items in stock)",
+			"err:", err.Error())
+		http.Error(w, "can`t set item in basket (not enough items in stock)", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		bh.Logger.Infow("can`t set item in basket",
+			"err:", err.Error())
+		http.Error(w, "can`t set item in basket", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(basket)
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal basket",
+			"err:", err.Error())
+		http.Error(w, "can`t get basket", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Set amounts of several items in basket at once
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Param 		 lines body []models.BasketLine true "new amounts, 0 removes item"
+// @Success      200  {object}  models.Basket
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /basket [put]
+func (bh *BasketHandler) SetItems(w http.ResponseWriter, r *http.Request) {
+	lines := []models.BasketLine{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		bh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, &lines)
+	if err != nil {
+		bh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	for _, line := range lines {
+		_, err = govalidator.ValidateStruct(line)
+		if err != nil {
+			bh.Logger.Infow("can`t validate form",
+				"err:", err.Error())
+			http.Error(w, "bad data", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID, err := bh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basket, err := bh.BasketService.SetItems(userID, lines)
+	if errors.Is(err, models.ErrOutOfStock) {
+		bh.Logger.Infow("can`t set items in basket (not enough items in stock)",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		bh.Logger.Infow("can`t set items in basket",
+			"err:", err.Error())
+		http.Error(w, "can`t set items in basket", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(basket)
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal basket",
+			"err:", err.Error())
+		http.Error(w, "can`t get basket", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Apply promo code to basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Param 		 promo body models.PromoApply true "promo code"
+// @Success      200  {object}  models.Basket
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /basket/promo [post]
+func (bh *BasketHandler) ApplyPromo(w http.ResponseWriter, r *http.Request) {
+	promo := &models.PromoApply{}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		bh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, promo)
+	if err != nil {
+		bh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(promo)
+	if err != nil {
+		bh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := bh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basket, err := bh.BasketService.ApplyPromo(userID, *promo)
+	if errors.Is(err, models.ErrBadPromo) {
+		bh.Logger.Infow("can`t apply promo code",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		bh.Logger.Infow("can`t apply promo code",
+			"err:", err.Error())
+		http.Error(w, "can`t apply promo code", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(basket)
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal basket",
+			"err:", err.Error())
+		http.Error(w, "can`t get basket", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Remove promo code from basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  models.Basket
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /basket/promo [delete]
+func (bh *BasketHandler) RemovePromo(w http.ResponseWriter, r *http.Request) {
+	userID, err := bh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basket, err := bh.BasketService.RemovePromo(userID)
+	if err != nil {
+		bh.Logger.Infow("can`t remove promo code",
+			"err:", err.Error())
+		http.Error(w, "can`t remove promo code", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(basket)
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal basket",
+			"err:", err.Error())
+		http.Error(w, "can`t get basket", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Create anonymous basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Success      201  {object}  GuestTokenForm
+// @Failure      500
+// @Router       /guest/basket [post]
+func (bh *BasketHandler) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	basketID, err := bh.BasketService.CreateGuest()
+	if err != nil {
+		bh.Logger.Errorw("can`t create guest basket",
+			"err:", err.Error())
+		http.Error(w, "can`t create guest basket", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := bh.Sessions.CreateGuestSession(basketID)
+	if err != nil {
+		bh.Logger.Errorw("can`t create guest session",
+			"err:", err.Error())
+		http.Error(w, "can`t make session", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(&GuestTokenForm{token})
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal guest token",
+			"err:", err.Error())
+		http.Error(w, "can`t make session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get all items in anonymous basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Param        X-Guest-Token    header	string  true  "Guest token"
+// @Success      200  {object}  models.Basket
+// @Failure      400
+// @Failure      401
+// @Failure      500
+// @Router       /guest/basket [get]
+func (bh *BasketHandler) GetGuest(w http.ResponseWriter, r *http.Request) {
+	basketID, err := bh.ContextManager.GuestBasketIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get guest basket from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basket, err := bh.BasketService.GetGuest(basketID)
+	if err != nil {
+		bh.Logger.Infow("can`t get guest basket",
+			"err:", err.Error())
+		http.Error(w, "can`t get basket", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(basket)
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal basket",
+			"err:", err.Error())
+		http.Error(w, "can`t get basket", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Add item to anonymous basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Param        X-Guest-Token    header	string  true  "Guest token"
+// @Param        ITEM_ID    path	integer  true  "ID of item adding to basket"
+// @Success      200
+// @Failure      400
+// @Failure      401
+// @Failure      409
+// @Failure      500
+// @Router       /guest/basket/{ITEM_ID} [post]
+func (bh *BasketHandler) AddGuestItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemIdString, ok := vars["ITEM_ID"]
+	if !ok {
+		bh.Logger.Errorw("no ITEM_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	itemId, err := strconv.Atoi(itemIdString)
+	if err != nil {
+		bh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basketID, err := bh.ContextManager.GuestBasketIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get guest basket from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	err = bh.BasketService.AddGuestItem(itemId, basketID)
+	if errors.Is(err, models.ErrOutOfStock) {
+		bh.Logger.Infow("can`t add item to guest basket (not enough items in stock)",
+			"err:", err.Error())
+		http.Error(w, "can`t add item to basket (not enough items in stock)", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		bh.Logger.Infow("can`t add item to guest basket (item is not available)",
+			"err:", err.Error())
+		http.Error(w, "can`t add item to basket (item is not available)", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write([]byte("success"))
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Remove item from anonymous basket
+// @Tags         basket
+// @Accept       json
+// @Produce      json
+// @Param        X-Guest-Token    header	string  true  "Guest token"
+// @Param        ITEM_ID    path	integer  true  "ID of item removing from basket"
+// @Success      200
+// @Failure      400
+// @Failure      401
+// @Failure      500
+// @Router       /guest/basket/{ITEM_ID} [delete]
+func (bh *BasketHandler) DecGuestItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemIdString, ok := vars["ITEM_ID"]
+	if !ok {
+		bh.Logger.Errorw("no ITEM_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	itemId, err := strconv.Atoi(itemIdString)
+	if err != nil {
+		bh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	basketID, err := bh.ContextManager.GuestBasketIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get guest basket from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	err = bh.BasketService.DecGuestItem(itemId, basketID)
+	if err != nil {
+		bh.Logger.Infow("can`t dec item from guest basket",
+			"err:", err.Error())
+		http.Error(w, "can`t dec item from basket", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write([]byte("success"))
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -13,22 +13,21 @@ type PgBasketRepo struct {
 }
 
 func (pbr *PgBasketRepo) Get(id int) (models.Basket, error) {
-	rows, err := pbr.DB.Queryx("select * from ItemsInUsersBasket($1)", id)
+	_, err := pbr.DB.Exec("select TouchUsersBasket($1)", id)
 	if err != nil {
-		return models.Basket{}, errors.Wrap(err, "can`t get from db, query: ")
+		return models.Basket{}, errors.Wrap(err, "can`t extend basket holds in db")
 	}
 
-	basket := models.NewBasket()
-
-	for rows.Next() {
-		item := models.OrderItem{}
+	_, err = pbr.DB.Exec("select MarkUsersBasketSeen($1)", id)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t mark basket prices as seen in db")
+	}
 
-		err := rows.StructScan(&item)
-		if err != nil {
-			return models.Basket{}, errors.Wrap(err, "can`t scan struct from db query result")
-		}
+	basket := models.NewBasket()
 
-		basket.Items = append(basket.Items, item)
+	err = pbr.DB.Select(&basket.Items, "select * from ItemsInUsersBasket($1)", id)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t get from db")
 	}
 
 	err = pbr.DB.Get(
@@ -51,22 +50,99 @@ func (pbr *PgBasketRepo) Get(id int) (models.Basket, error) {
 
 	basket.Price = price
 
+	err = pbr.DB.Get(
+		&basket.Promo,
+		"select coalesce(p.code, '') from Ordering o left join PromoCode p on o.promo_id = p.id where o.id = $1",
+		basket.ID)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t get from db")
+	}
+
+	err = pbr.DB.Get(
+		&basket.Discount,
+		"select BasketDiscount($1)",
+		id)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t get from db")
+	}
+
+	basket.Total = basket.Price - basket.Discount
+
 	return *basket, nil
 }
 
+func (pbr *PgBasketRepo) ReleaseExpiredHolds() (int, error) {
+	var released int
+
+	err := pbr.DB.Get(&released, "select ReleaseExpiredHolds()")
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t release expired holds in db")
+	}
+
+	return released, nil
+}
+
+func basketResultError(res int, itemID int) error {
+	if res == 1 {
+		return errors.Wrapf(models.ErrItemNotAvailable, "can`t put item %d in basket", itemID)
+	} else if res == 2 {
+		return errors.Wrapf(models.ErrOutOfStock, "can`t put item %d in basket", itemID)
+	}
+
+	return nil
+}
 
 func (pbr *PgBasketRepo) AddItem(itemID, userID int) error {
-	var succ bool
+	var res int
 	err := pbr.DB.Get(
-		&succ,
+		&res,
 		"SELECT AddItemUsersBasket($1, $2, $3)", itemID, userID, 1)
-	if !succ {
-		return errors.Wrap(err, "Item is not available")
-	}
 	if err != nil {
 		return errors.Wrap(err, "can`t add item in basket in db")
 	}
 
+	return basketResultError(res, itemID)
+}
+
+func (pbr *PgBasketRepo) SetItem(itemID, userID, amount int) error {
+	var res int
+	err := pbr.DB.Get(
+		&res,
+		"SELECT SetItemUsersBasket($1, $2, $3)", itemID, userID, amount)
+	if err != nil {
+		return errors.Wrap(err, "can`t set item in basket in db")
+	}
+
+	return basketResultError(res, itemID)
+}
+
+func (pbr *PgBasketRepo) SetItems(userID int, lines []models.BasketLine) error {
+	tx, err := pbr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	for _, line := range lines {
+		var res int
+		err = tx.Get(
+			&res,
+			"SELECT SetItemUsersBasket($1, $2, $3)", line.ItemID, userID, line.Amount)
+		if err != nil {
+			return errors.Wrap(err, "can`t set item in basket in db")
+		}
+
+		err = basketResultError(res, line.ItemID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
 	return nil
 }
 
@@ -79,3 +155,112 @@ func (pbr *PgBasketRepo) DecItem(itemID, userID int) error {
 
 	return nil
 }
+
+var promoErrors = map[int]string{
+	1: "promo code not found",
+	2: "promo code is expired",
+	3: "promo code usage limit is reached",
+	4: "basket total is too small for promo code",
+	5: "no items in basket match promo code",
+}
+
+func (pbr *PgBasketRepo) ApplyPromo(userID int, code string) error {
+	var res int
+	err := pbr.DB.Get(
+		&res,
+		"SELECT ApplyPromo($1, $2)", userID, code)
+	if err != nil {
+		return errors.Wrap(err, "can`t apply promo code in db")
+	}
+
+	if res != 0 {
+		return errors.Wrap(models.ErrBadPromo, promoErrors[res])
+	}
+
+	return nil
+}
+
+func (pbr *PgBasketRepo) RemovePromo(userID int) error {
+	_, err := pbr.DB.Exec(
+		"update Ordering set promo_id = null where user_id = $1 and current_status = 'корзина'", userID)
+	if err != nil {
+		return errors.Wrap(err, "can`t remove promo code in db")
+	}
+
+	return nil
+}
+
+func (pbr *PgBasketRepo) CreateGuest() (int, error) {
+	var id int
+
+	err := pbr.DB.QueryRow(
+		"insert into GuestBasket default values returning id",
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t insert to db")
+	}
+
+	return id, nil
+}
+
+func (pbr *PgBasketRepo) GetGuest(id int) (models.Basket, error) {
+	basket := models.NewBasket()
+	basket.ID = id
+
+	err := pbr.DB.Select(&basket.Items, "select * from ItemsInGuestBasket($1)", id)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t get from db")
+	}
+
+	for _, item := range basket.Items {
+		basket.Price += item.Price * item.Amount
+	}
+
+	basket.Total = basket.Price
+
+	return *basket, nil
+}
+
+func (pbr *PgBasketRepo) AddGuestItem(itemID, basketID int) error {
+	var res int
+	err := pbr.DB.Get(
+		&res,
+		"SELECT AddItemGuestBasket($1, $2, $3)", itemID, basketID, 1)
+	if err != nil {
+		return errors.Wrap(err, "can`t add item in guest basket in db")
+	}
+
+	if res == 1 {
+		return errors.Wrap(models.ErrItemNotAvailable, "can`t add item in guest basket")
+	} else if res == 2 {
+		return errors.Wrap(models.ErrOutOfStock, "can`t add item in guest basket")
+	} else if res == 3 {
+		return errors.Errorf("guest basket %d not found", basketID)
+	}
+
+	return nil
+}
+
+func (pbr *PgBasketRepo) DecGuestItem(itemID, basketID int) error {
+	_, err := pbr.DB.Exec(
+		"SELECT DecItemGuestBasket($1, $2, $3)", itemID, basketID, 1)
+	if err != nil {
+		return errors.Wrap(err, "can`t dec item from guest basket in db")
+	}
+
+	return nil
+}
+
+func (pbr *PgBasketRepo) MergeGuest(basketID, userID int) error {
+	var merged int
+	err := pbr.DB.Get(
+		&merged,
+		"SELECT MergeGuestBasket($1, $2)", basketID, userID)
+	if err != nil {
+		return errors.Wrap(err, "can`t merge guest basket in db")
+	}
+
+	pbr.Logger.Debugw("PgBasketRepo.MergeGuest()", "basket", basketID, "user", userID, "merged", merged)
+
+	return nil
+}
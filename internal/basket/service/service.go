@@ -1,6 +1,8 @@
 package service
 
 import (
+	"time"
+
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
 	"github.com/pkg/errors"
@@ -10,6 +12,16 @@ type BasketRepo interface {
 	Get(int) (models.Basket, error)
 	AddItem(int, int) error
 	DecItem(int, int) error
+	SetItem(int, int, int) error
+	SetItems(int, []models.BasketLine) error
+	ApplyPromo(int, string) error
+	RemovePromo(int) error
+	CreateGuest() (int, error)
+	GetGuest(int) (models.Basket, error)
+	AddGuestItem(int, int) error
+	DecGuestItem(int, int) error
+	MergeGuest(int, int) error
+	ReleaseExpiredHolds() (int, error)
 }
 
 type BasketService struct {
@@ -17,12 +29,36 @@ type BasketService struct {
 	Logger     logger.Logger
 }
 
+// basketWarnings reports lines whose item became unavailable or whose price
+// differs from the one recorded when the line was added.
+func basketWarnings(basket *models.Basket) {
+	for _, line := range basket.Items {
+		if !line.IsAvailable {
+			basket.Warnings = append(basket.Warnings, models.BasketWarning{
+				ItemID: line.ID,
+				Kind:   models.BasketWarningUnavailable,
+			})
+		}
+
+		if line.AddedPrice != nil && *line.AddedPrice != line.Price {
+			basket.Warnings = append(basket.Warnings, models.BasketWarning{
+				ItemID:   line.ID,
+				Kind:     models.BasketWarningPriceChanged,
+				OldPrice: *line.AddedPrice,
+				NewPrice: line.Price,
+			})
+		}
+	}
+}
+
 func (bs BasketService) Get(id int) (models.Basket, error) {
 	basket, err := bs.BasketRepo.Get(id)
 	if err != nil {
 		return models.Basket{}, errors.Wrap(err, "can`t get from repo")
 	}
 
+	basketWarnings(&basket)
+
 	return basket, nil
 }
 
@@ -43,3 +79,127 @@ func (bs BasketService) DecItem(itemID, userID int) error {
 
 	return nil
 }
+
+func (bs BasketService) SetItem(itemID, userID int, line models.BasketLine) (models.Basket, error) {
+	if line.Amount < 0 {
+		return models.Basket{}, errors.Errorf("amount of item %d can`t be negative", itemID)
+	}
+
+	err := bs.BasketRepo.SetItem(itemID, userID, line.Amount)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t set item in repo")
+	}
+
+	return bs.Get(userID)
+}
+
+func (bs BasketService) SetItems(userID int, lines []models.BasketLine) (models.Basket, error) {
+	seen := map[int]bool{}
+	for _, line := range lines {
+		if line.Amount < 0 {
+			return models.Basket{}, errors.Errorf("amount of item %d can`t be negative", line.ItemID)
+		}
+		if seen[line.ItemID] {
+			return models.Basket{}, errors.Errorf("item %d is listed twice", line.ItemID)
+		}
+		seen[line.ItemID] = true
+	}
+
+	err := bs.BasketRepo.SetItems(userID, lines)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t set items in repo")
+	}
+
+	return bs.Get(userID)
+}
+
+func (bs BasketService) ApplyPromo(userID int, promo models.PromoApply) (models.Basket, error) {
+	err := bs.BasketRepo.ApplyPromo(userID, promo.Code)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t apply promo in repo")
+	}
+
+	return bs.Get(userID)
+}
+
+func (bs BasketService) RemovePromo(userID int) (models.Basket, error) {
+	err := bs.BasketRepo.RemovePromo(userID)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t remove promo in repo")
+	}
+
+	return bs.Get(userID)
+}
+
+func (bs BasketService) CreateGuest() (int, error) {
+	id, err := bs.BasketRepo.CreateGuest()
+	if err != nil {
+		return -1, errors.Wrap(err, "can`t add to repo")
+	}
+
+	return id, nil
+}
+
+func (bs BasketService) GetGuest(id int) (models.Basket, error) {
+	basket, err := bs.BasketRepo.GetGuest(id)
+	if err != nil {
+		return models.Basket{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	basketWarnings(&basket)
+
+	return basket, nil
+}
+
+func (bs BasketService) AddGuestItem(itemID, basketID int) error {
+	err := bs.BasketRepo.AddGuestItem(itemID, basketID)
+	if err != nil {
+		return errors.Wrap(err, "can`t add item in repo")
+	}
+
+	return nil
+}
+
+func (bs BasketService) DecGuestItem(itemID, basketID int) error {
+	err := bs.BasketRepo.DecGuestItem(itemID, basketID)
+	if err != nil {
+		return errors.Wrap(err, "can`t dec item in repo")
+	}
+
+	return nil
+}
+
+func (bs BasketService) MergeGuest(basketID, userID int) error {
+	err := bs.BasketRepo.MergeGuest(basketID, userID)
+	if err != nil {
+		return errors.Wrap(err, "can`t merge guest basket in repo")
+	}
+
+	return nil
+}
+
+// RunHoldSweeper periodically releases stock reserved by basket lines whose
+// hold has expired. It blocks until stop is closed.
+func (bs BasketService) RunHoldSweeper(period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			released, err := bs.BasketRepo.ReleaseExpiredHolds()
+			if err != nil {
+				bs.Logger.Errorw("can`t release expired basket holds",
+					"err", err.Error())
+				continue
+			}
+
+			if released > 0 {
+				bs.Logger.Infow("released expired basket holds",
+					"items", released)
+			}
+		}
+	}
+}
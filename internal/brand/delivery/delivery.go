@@ -1,6 +1,8 @@
 package delivery
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -8,21 +10,128 @@ import (
 
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"github.com/pkg/errors"
 )
 
 type BrandService interface {
 	Create(models.Brand) (int, error)
 	Get(int) (models.Brand, error)
-	Update(models.Brand) (models.Brand, error)
-	Delete(int) error
+	Update(models.Brand, int, string) (models.Brand, error)
+	Delete(int, models.BrandDelete) (int, error)
+	GetAll(models.BrandsParams) ([]models.BrandSummary, models.PageInfo, error)
+	AddManager(int, int) error
+	RemoveManager(int, int) error
+}
+
+type ContextManager interface {
+	UserIDFromContext(ctx context.Context) (int, error)
+	UserRoleFromContext(ctx context.Context) (string, error)
 }
 
 type BrandHandler struct {
-	BrandService BrandService
-	Logger       logger.Logger
+	BrandService   BrandService
+	ContextManager ContextManager
+	Logger         logger.Logger
+}
+
+// user reads the id and the role of the authorized user, writing the error
+// response when they are missing.
+func (bh *BrandHandler) user(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	userID, err := bh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+
+	userRole, err := bh.ContextManager.UserRoleFromContext(r.Context())
+	if err != nil {
+		bh.Logger.Errorw("fail to get role from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+
+	return userID, userRole, true
+}
+
+// @Summary      Get list of brands with their item counts and price ranges
+// @Tags         brands
+// @Accept       json
+// @Produce      json
+// @Param        q    query	string  false  "Part of the brand name"
+// @Param        OrderBy    query	string  false  "Sort by name|year|any"
+// @Param        Order    query	string  false  "asc|desc"
+// @Param        Page_size    query	integer  false  "Size of page, 20 by default, at most 100"
+// @Param        Page_num    query	integer  false  "Number of page, starting from 1"
+// @Param        cursor    query	string  false  "Next page cursor from next_cursor or X-Next-Cursor"
+// @Param        with_total    query	boolean  false  "Count all matching brands into total and X-Total-Count"
+// @Success      200  {object}  models.BrandsPage
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, absent on the last one"
+// @Header       200  {integer}  X-Total-Count  "Number of matching brands, with with_total only"
+// @Header       200  {string}  Link  "Next page, rel=next"
+// @Failure      400
+// @Failure      500
+// @Router       /brands [get]
+func (bh *BrandHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		bh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	brandsParams := new(models.BrandsParams)
+	err = schema.NewDecoder().Decode(brandsParams, r.Form)
+	if err != nil {
+		bh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(brandsParams)
+	if err != nil {
+		bh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	brands, page, err := bh.BrandService.GetAll(*brandsParams)
+	if err != nil {
+		bh.Logger.Infow("can`t get brands",
+			"err:", err.Error())
+		http.Error(w, "can`t get brands", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(models.BrandsPage{Brands: brands, PageInfo: page})
+
+	if err != nil {
+		bh.Logger.Errorw("can`t marshal brands",
+			"err:", err.Error())
+		http.Error(w, "can`t make brands", http.StatusInternalServerError)
+		return
+	}
+
+	pagination.WriteHeaders(w, r, page.NextCursor, page.Total)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		bh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
 }
 
 // @Summary      Get an information about one brand
@@ -120,6 +229,12 @@ func (bh *BrandHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	brand.ID, err = bh.BrandService.Create(*brand)
+	if errors.Is(err, models.ErrNoImage) {
+		bh.Logger.Infow("can`t create brand",
+			"err:", err.Error())
+		http.Error(w, "no such image", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		bh.Logger.Infow("can`t create brand",
 			"err:", err.Error())
@@ -156,6 +271,7 @@ func (bh *BrandHandler) Create(w http.ResponseWriter, r *http.Request) {
 // @Success      200  
 // @Failure      400
 // @Failure      401
+// @Failure      403
 // @Failure      404  
 // @Failure      500  
 // @Security ApiKeyAuth
@@ -203,8 +319,25 @@ func (bh *BrandHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, userRole, ok := bh.user(w, r)
+	if !ok {
+		return
+	}
+
 	brand.ID = brandId
-	*brand, err = bh.BrandService.Update(*brand)
+	*brand, err = bh.BrandService.Update(*brand, userID, userRole)
+	if errors.Is(err, models.ErrForbidden) {
+		bh.Logger.Infow("can`t update brand",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrNoImage) {
+		bh.Logger.Infow("can`t update brand",
+			"err:", err.Error())
+		http.Error(w, "no such image", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		bh.Logger.Infow("can`t update brand",
 			"err:", err.Error())
@@ -233,13 +366,18 @@ func (bh *BrandHandler) Update(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary      Delete brand
+// @Description  A brand that still has items is deleted only with reassign_to, which moves the items to another brand, or with archive, which hides the brand and its items
 // @Tags         brands
 // @Accept       json
 // @Produce      json
 // @Param        BRAND_ID    path	integer  true  "ID of deleted brand"
+// @Param        reassign_to    query	integer  false  "Brand to move the items to"
+// @Param        archive    query	boolean  false  "Hide the brand and its items instead of deleting"
 // @Success      200 
+// @Failure      400
 // @Failure      401
 // @Failure      404  
+// @Failure      409  {object}  models.BrandInUse
 // @Failure      500  
 // @Security ApiKeyAuth
 // @Router       /brands/{BRAND_ID} [delete]
@@ -260,7 +398,51 @@ func (bh *BrandHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bh.BrandService.Delete(brandId)
+	err = r.ParseForm()
+	if err != nil {
+		bh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	mode := new(models.BrandDelete)
+	err = schema.NewDecoder().Decode(mode, r.Form)
+	if err != nil {
+		bh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	blocking, err := bh.BrandService.Delete(brandId, *mode)
+	if errors.Is(err, models.ErrBrandInUse) {
+		bh.Logger.Infow("can`t delete brand",
+			"err:", err.Error())
+
+		resp, err := json.Marshal(models.BrandInUse{BlockingItems: blocking})
+		if err != nil {
+			bh.Logger.Errorw("can`t marshal blocking items",
+				"err:", err.Error())
+			http.Error(w, "can`t make blocking items", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusConflict)
+
+		_, err = w.Write(resp)
+		if err != nil {
+			bh.Logger.Errorw("can`t write response",
+				"err:", err.Error())
+		}
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		bh.Logger.Infow("can`t delete brand",
+			"err:", err.Error())
+		http.Error(w, "no such brand", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		bh.Logger.Infow("can`t delete brand",
 			"err:", err.Error())
@@ -270,3 +452,105 @@ func (bh *BrandHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// @Summary      Let a user manage the brand
+// @Description  A plain user becomes a brand manager and may edit the brand and its items after logging in again
+// @Tags         brands
+// @Accept       json
+// @Produce      json
+// @Param        BRAND_ID    path	integer  true  "ID of brand"
+// @Param        USER_ID    path	integer  true  "ID of user"
+// @Success      200
+// @Failure      401
+// @Failure      403
+// @Failure      404
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /brands/{BRAND_ID}/managers/{USER_ID} [put]
+func (bh *BrandHandler) AddManager(w http.ResponseWriter, r *http.Request) {
+	brandID, userID, ok := bh.brandAndUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := bh.BrandService.AddManager(brandID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		bh.Logger.Infow("can`t add brand manager",
+			"err:", err.Error())
+		http.Error(w, "no such brand", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrBadManager) {
+		bh.Logger.Infow("can`t add brand manager",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		bh.Logger.Infow("can`t add brand manager",
+			"err:", err.Error())
+		http.Error(w, "can`t add brand manager", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary      Stop a user from managing the brand
+// @Tags         brands
+// @Accept       json
+// @Produce      json
+// @Param        BRAND_ID    path	integer  true  "ID of brand"
+// @Param        USER_ID    path	integer  true  "ID of user"
+// @Success      200
+// @Failure      401
+// @Failure      403
+// @Failure      404
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /brands/{BRAND_ID}/managers/{USER_ID} [delete]
+func (bh *BrandHandler) RemoveManager(w http.ResponseWriter, r *http.Request) {
+	brandID, userID, ok := bh.brandAndUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := bh.BrandService.RemoveManager(brandID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		bh.Logger.Infow("can`t remove brand manager",
+			"err:", err.Error())
+		http.Error(w, "no such brand manager", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		bh.Logger.Infow("can`t remove brand manager",
+			"err:", err.Error())
+		http.Error(w, "can`t remove brand manager", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (bh *BrandHandler) brandAndUser(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+
+	brandID, err := strconv.Atoi(vars["BRAND_ID"])
+	if err != nil {
+		bh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+
+	userID, err := strconv.Atoi(vars["USER_ID"])
+	if err != nil {
+		bh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+
+	return brandID, userID, true
+}
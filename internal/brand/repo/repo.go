@@ -1,8 +1,13 @@
 package repo
 
 import (
+	"database/sql"
+	"strings"
+
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
+	"github.com/el1ljah/cp_db/pkg/querybuilder"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
@@ -31,14 +36,18 @@ func (pbr *PgBrandRepo) Create(brand models.Brand) (int, error) {
 	return id, nil
 }
 
+// brandHasLogo tells whether the logo of the brand was uploaded, since brands
+// from the seed data point at pictures that were never stored.
+const brandHasLogo = "exists(select 1 from Image im where im.id = b.logo_id) as has_logo"
+
 func (pbr *PgBrandRepo) Get(id int) (models.Brand, error) {
 	brand := models.Brand{}
 
 	err := pbr.DB.Get(
 		&brand,
-		"select * "+
-			"from Brand "+
-			"where id = $1",
+		"select b.*, "+brandHasLogo+" "+
+			"from Brand b "+
+			"where b.id = $1 and not b.archived",
 		id)
 	if err != nil {
 		return brand, errors.Wrap(err, "can`t get from db")
@@ -53,7 +62,7 @@ func (pbr *PgBrandRepo) Update(brand models.Brand) (models.Brand, error) {
 			"set brand_name = $1, "+
 			"founding_year = $2, "+
 			"logo_id = $3, "+
-			"brand_owner = $4"+
+			"brand_owner = $4 "+
 			"where id = $5",
 		brand.Name,
 		brand.Year,
@@ -67,14 +76,339 @@ func (pbr *PgBrandRepo) Update(brand models.Brand) (models.Brand, error) {
 	return brand, nil
 }
 
-func (pbr *PgBrandRepo) Delete(id int) error {
-	_, err := pbr.DB.Exec(
-		"delete from Brand "+
-			"where id = $1",
+// Delete removes the brand, or archives it when mode.Archive is set. Items
+// of the brand are moved to mode.ReassignTo or hidden along with it, and
+// without a mode their number is returned with ErrBrandInUse.
+func (pbr *PgBrandRepo) Delete(id int, mode models.BrandDelete) (int, error) {
+	tx, err := pbr.DB.Beginx()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	var locked, items int
+
+	err = tx.Get(&locked,
+		"select id "+
+			"from Brand "+
+			"where id = $1 and not archived "+
+			"for update",
 		id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t lock brand in db")
+	}
+
+	err = tx.Get(&items,
+		"select count(*) "+
+			"from Item "+
+			"where brand_id = $1",
+		id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t count items in db")
+	}
+
+	switch {
+	case mode.ReassignTo != 0:
+		var target int
+
+		err = tx.Get(&target,
+			"select id "+
+				"from Brand "+
+				"where id = $1 and not archived "+
+				"for share",
+			mode.ReassignTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.Wrapf(models.ErrBadBrandDelete, "no brand %d to reassign items to", mode.ReassignTo)
+		} else if err != nil {
+			return 0, errors.Wrap(err, "can`t get from db")
+		}
+
+		_, err = tx.Exec(
+			"update Item "+
+				"set brand_id = $1 "+
+				"where brand_id = $2",
+			mode.ReassignTo,
+			id)
+		if err != nil {
+			return 0, errors.Wrap(err, "can`t reassign items in db")
+		}
+	case mode.Archive:
+		// Items keep their availability: the archived flag alone hides them
+		// from listings and baskets, so nothing is lost if the brand returns.
+		_, err = tx.Exec(
+			"update Brand "+
+				"set archived = true "+
+				"where id = $1",
+			id)
+		if err != nil {
+			return 0, errors.Wrap(err, "can`t archive brand in db")
+		}
+	case items > 0:
+		return items, errors.Wrapf(models.ErrBrandInUse, "brand %d has %d items", id, items)
+	}
+
+	if !mode.Archive {
+		// The managers of the brand lose their bindings along with it, so
+		// those left without brands are demoted as RemoveManager does.
+		_, err = tx.Exec(
+			"update webUser u "+
+				"set user_role = $1 "+
+				"where u.user_role = $2 "+
+				"and u.user_id in (select user_id from BrandManager where brand_id = $3) "+
+				"and not exists (select 1 from BrandManager m where m.user_id = u.user_id and m.brand_id != $3)",
+			models.UserRoleUser,
+			models.UserRoleBrandManager,
+			id)
+		if err != nil {
+			return 0, errors.Wrap(err, "can`t update table in db")
+		}
+
+		_, err = tx.Exec(
+			"delete from Brand "+
+				"where id = $1",
+			id)
+		if err != nil {
+			return 0, errors.Wrap(err, "can`t delete from db")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return 0, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func brandsSelect(params models.BrandsParams, columns ...string) *querybuilder.SelectBuilder {
+	sb := querybuilder.Select(columns...).
+		From("Brand b").
+		Join("left join Item i on i.brand_id = b.id").
+		Where("not b.archived")
+
+	if params.Q != "" {
+		sb.Where("lower(b.brand_name) like ?", "%"+likeEscaper.Replace(strings.ToLower(params.Q))+"%")
+	}
+
+	return sb.GroupBy("b.id")
+}
+
+// brandOrder returns the ordering and direction the brands are listed in.
+func brandOrder(params models.BrandsParams) (string, string) {
+	orderBy := params.OrderBy
+	if orderBy != models.BrandsOrderName && orderBy != models.BrandsOrderYear {
+		orderBy = models.ItemsParamsAny
+	}
+
+	order := models.ItemsOrderAsc
+	if params.Order == models.ItemsOrderDesc {
+		order = models.ItemsOrderDesc
+	}
+
+	return orderBy, order
+}
+
+// brandSortKeys returns the keyset for the ordering, always ending with the
+// id so that it is unique.
+func brandSortKeys(orderBy, order string) ([]querybuilder.SortKey, func(models.BrandSummary) []interface{}) {
+	desc := order == models.ItemsOrderDesc
+
+	switch orderBy {
+	case models.BrandsOrderName:
+		return []querybuilder.SortKey{{Expr: "b.brand_name", Desc: desc}, {Expr: "b.id"}},
+			func(brand models.BrandSummary) []interface{} { return []interface{}{brand.Name, brand.ID} }
+	case models.BrandsOrderYear:
+		return []querybuilder.SortKey{{Expr: "b.founding_year", Desc: desc}, {Expr: "b.id"}},
+			func(brand models.BrandSummary) []interface{} { return []interface{}{brand.Year, brand.ID} }
+	default:
+		return []querybuilder.SortKey{{Expr: "b.id", Desc: desc}},
+			func(brand models.BrandSummary) []interface{} { return []interface{}{brand.ID} }
+	}
+}
+
+// GetAll returns one page of brands with their item counts and price ranges,
+// and the cursor of the next page, empty on the last one.
+func (pbr *PgBrandRepo) GetAll(params models.BrandsParams) ([]models.BrandSummary, string, error) {
+	brands := []models.BrandSummary{}
+	orderBy, order := brandOrder(params)
+	keys, values := brandSortKeys(orderBy, order)
+
+	sb := brandsSelect(params,
+		"b.*",
+		brandHasLogo,
+		"count(i.id) as item_count",
+		"coalesce(min(i.price), 0) as min_price",
+		"coalesce(max(i.price), 0) as max_price")
+	offset := 0
+
+	if params.Cursor != "" {
+		cursor, err := pagination.DecodeKeys(params.Cursor, orderBy, order, len(keys))
+		if err != nil {
+			return brands, "", err
+		}
+
+		sb.After(keys, cursor.Values)
+	} else if params.Page_num > 1 {
+		offset = (params.Page_num - 1) * params.Page_size
+	}
+
+	query, args := sb.OrderByKeys(keys...).
+		Limit(params.Page_size + 1).
+		Offset(offset).
+		Build()
+
+	pbr.Logger.Debugw("PgBrandRepo.GetAll()", "query", query, "args", args)
+	err := pbr.DB.Select(&brands, query, args...)
+	if err != nil {
+		return brands, "", errors.Wrap(err, "can`t get from db")
+	}
+
+	if len(brands) <= params.Page_size {
+		return brands, "", nil
+	}
+
+	brands = brands[:params.Page_size]
+
+	return brands, pagination.Encode(pagination.Cursor{
+		OrderBy: orderBy,
+		Order:   order,
+		Values:  values(brands[len(brands)-1]),
+	}), nil
+}
+
+func (pbr *PgBrandRepo) Count(params models.BrandsParams) (int, error) {
+	var total int
+
+	query, args := brandsSelect(params, "b.id").BuildCount()
+	err := pbr.DB.Get(&total, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t count in db")
+	}
+
+	return total, nil
+}
+
+func (pbr *PgBrandRepo) ManagedBrands(userID int) ([]int, error) {
+	brands := []int{}
+
+	err := pbr.DB.Select(&brands,
+		"select brand_id "+
+			"from BrandManager "+
+			"where user_id = $1 "+
+			"order by brand_id",
+		userID)
+	if err != nil {
+		return brands, errors.Wrap(err, "can`t get from db")
+	}
+
+	return brands, nil
+}
+
+// AddManager binds the brand to the user, turning a plain user into a brand
+// manager, who can still use every customer route. Admins manage every brand
+// anyway and can`t be bound.
+func (pbr *PgBrandRepo) AddManager(brandID, userID int) error {
+	tx, err := pbr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	var brand int
+
+	err = tx.Get(&brand,
+		"select id "+
+			"from Brand "+
+			"where id = $1 and not archived "+
+			"for share",
+		brandID)
+	if err != nil {
+		return errors.Wrap(err, "can`t get from db")
+	}
+
+	res, err := tx.Exec(
+		"update webUser "+
+			"set user_role = $1 "+
+			"where user_id = $2 and user_role in ($3, $1)",
+		models.UserRoleBrandManager,
+		userID,
+		models.UserRoleUser)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected == 0 {
+		return errors.Wrapf(models.ErrBadManager, "no user %d with role %s or %s", userID, models.UserRoleUser, models.UserRoleBrandManager)
+	}
+
+	_, err = tx.Exec(
+		"insert into BrandManager (user_id, brand_id) "+
+			"values ($1, $2) "+
+			"on conflict do nothing",
+		userID,
+		brandID)
+	if err != nil {
+		return errors.Wrap(err, "can`t insert to db")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return nil
+}
+
+// RemoveManager unbinds the brand from the user and makes them a plain user
+// again once they manage no brands.
+func (pbr *PgBrandRepo) RemoveManager(brandID, userID int) error {
+	tx, err := pbr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"delete from BrandManager "+
+			"where user_id = $1 and brand_id = $2",
+		userID,
+		brandID)
 	if err != nil {
 		return errors.Wrap(err, "can`t delete from db")
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected == 0 {
+		return errors.Wrapf(sql.ErrNoRows, "user %d doesn`t manage brand %d", userID, brandID)
+	}
+
+	_, err = tx.Exec(
+		"update webUser "+
+			"set user_role = $1 "+
+			"where user_id = $2 and user_role = $3 "+
+			"and not exists (select 1 from BrandManager where user_id = $2)",
+		models.UserRoleUser,
+		userID,
+		models.UserRoleBrandManager)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
 	return nil
 }
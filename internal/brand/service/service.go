@@ -3,6 +3,7 @@ package service
 import (
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
 	"github.com/pkg/errors"
 )
 
@@ -10,15 +11,31 @@ type BrandRepo interface {
 	Create(models.Brand) (int, error)
 	Get(int) (models.Brand, error)
 	Update(models.Brand) (models.Brand, error)
-	Delete(int) error
+	Delete(int, models.BrandDelete) (int, error)
+	GetAll(models.BrandsParams) ([]models.BrandSummary, string, error)
+	Count(models.BrandsParams) (int, error)
+	ManagedBrands(int) ([]int, error)
+	AddManager(int, int) error
+	RemoveManager(int, int) error
+}
+
+// ImageChecker tells whether an image was uploaded.
+type ImageChecker interface {
+	Check(id int) error
 }
 
 type BrandService struct {
 	BrandRepo BrandRepo
+	Images    ImageChecker
 	Logger    logger.Logger
 }
 
 func (bs BrandService) Create(brand models.Brand) (int, error) {
+	err := bs.Images.Check(brand.Logo)
+	if err != nil {
+		return -1, err
+	}
+
 	id, err := bs.BrandRepo.Create(brand)
 	if err != nil {
 		return -1, errors.Wrap(err, "can`t add to repo")
@@ -33,20 +50,135 @@ func (bs BrandService) Get(id int) (models.Brand, error) {
 		return models.Brand{}, errors.Wrap(err, "can`t get from repo")
 	}
 
+	brand.SetLogoURL()
+
 	return brand, nil
 }
 
-func (bs BrandService) Update(brand models.Brand) (models.Brand, error) {
-	brand, err := bs.BrandRepo.Update(brand)
+func (bs BrandService) ManagedBrands(userID int) ([]int, error) {
+	brands, err := bs.BrandRepo.ManagedBrands(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return brands, nil
+}
+
+// CheckAccess lets admins through, and brand managers only when they manage
+// every one of the given brands.
+func (bs BrandService) CheckAccess(userID int, role string, brandIDs ...int) error {
+	if role == models.UserRoleAdmin {
+		return nil
+	}
+	if role != models.UserRoleBrandManager {
+		return errors.Wrapf(models.ErrForbidden, "role %s can`t manage brands", role)
+	}
+
+	managed, err := bs.ManagedBrands(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range brandIDs {
+		found := false
+		for _, brand := range managed {
+			if brand == id {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.Wrapf(models.ErrForbidden, "user %d doesn`t manage brand %d", userID, id)
+		}
+	}
+
+	return nil
+}
+
+// Update keeps a logo id left as it was even if the picture was never
+// uploaded, so that seeded brands stay editable.
+func (bs BrandService) Update(brand models.Brand, userID int, role string) (models.Brand, error) {
+	err := bs.CheckAccess(userID, role, brand.ID)
+	if err != nil {
+		return brand, err
+	}
+
+	current, err := bs.Get(brand.ID)
+	if err != nil {
+		return brand, err
+	}
+
+	if brand.Logo != current.Logo {
+		err = bs.Images.Check(brand.Logo)
+		if err != nil {
+			return brand, err
+		}
+	}
+
+	_, err = bs.BrandRepo.Update(brand)
 	if err != nil {
 		return brand, errors.Wrap(err, "can`t update repo")
 	}
 
-	return brand, nil
+	return bs.Get(brand.ID)
+}
+
+// Delete returns the number of items that keep the brand from being deleted
+// along with ErrBrandInUse.
+func (bs BrandService) Delete(id int, mode models.BrandDelete) (int, error) {
+	if mode.ReassignTo != 0 && mode.Archive {
+		return 0, errors.Wrap(models.ErrBadBrandDelete, "can`t both reassign and archive items")
+	}
+	if mode.ReassignTo == id {
+		return 0, errors.Wrap(models.ErrBadBrandDelete, "can`t reassign items to the same brand")
+	}
+
+	blocking, err := bs.BrandRepo.Delete(id, mode)
+	if err != nil {
+		return blocking, errors.Wrap(err, "can`t delete from repo")
+	}
+
+	return 0, nil
+}
+
+func (bs BrandService) GetAll(params models.BrandsParams) ([]models.BrandSummary, models.PageInfo, error) {
+	params.Page_size = pagination.Size(params.Page_size)
+
+	brands, next, err := bs.BrandRepo.GetAll(params)
+	if err != nil {
+		return nil, models.PageInfo{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	for i := range brands {
+		brands[i].SetLogoURL()
+	}
+
+	page := models.PageInfo{NextCursor: next}
+
+	if params.WithTotal {
+		total, err := bs.BrandRepo.Count(params)
+		if err != nil {
+			return nil, models.PageInfo{}, errors.Wrap(err, "can`t count in repo")
+		}
+
+		page.Total = &total
+	}
+
+	return brands, page, nil
+}
+
+func (bs BrandService) AddManager(brandID, userID int) error {
+	err := bs.BrandRepo.AddManager(brandID, userID)
+	if err != nil {
+		return errors.Wrap(err, "can`t add to repo")
+	}
+
+	return nil
 }
 
-func (bs BrandService) Delete(id int) error {
-	err := bs.BrandRepo.Delete(id)
+func (bs BrandService) RemoveManager(brandID, userID int) error {
+	err := bs.BrandRepo.RemoveManager(brandID, userID)
 	if err != nil {
 		return errors.Wrap(err, "can`t delete from repo")
 	}
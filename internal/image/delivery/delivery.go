@@ -0,0 +1,208 @@
+package delivery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/blobstore"
+	"github.com/el1ljah/cp_db/pkg/logger"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"github.com/pkg/errors"
+)
+
+const (
+	imageFormField = "image"
+
+	// multipartOverhead is allowed on top of the image itself for the
+	// boundaries and part headers of the upload.
+	multipartOverhead = 64 << 10
+
+	// imageCacheControl lets clients keep images forever: an uploaded image
+	// never changes, a new one gets a new id.
+	imageCacheControl = "public, max-age=31536000, immutable"
+)
+
+type ImageService interface {
+	Upload([]byte) (models.Image, error)
+	Open(int) (models.Image, io.ReadCloser, error)
+	OpenVariant(int, string) (models.ImageVariant, io.ReadCloser, error)
+}
+
+type ImageHandler struct {
+	ImageService ImageService
+	Logger       logger.Logger
+}
+
+func (ih *ImageHandler) writeError(w http.ResponseWriter, err error, msg string) {
+	ih.Logger.Infow(msg,
+		"err:", err.Error())
+
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, models.ErrImageTooLarge), errors.As(err, &maxBytesErr):
+		http.Error(w, models.ErrImageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, models.ErrBadImage):
+		http.Error(w, models.ErrBadImage.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, blobstore.ErrNotFound):
+		http.Error(w, "no such image", http.StatusNotFound)
+	default:
+		http.Error(w, msg, http.StatusBadRequest)
+	}
+}
+
+// @Summary      Upload an image
+// @Description  The picture is checked by its content and must be a JPEG, PNG or GIF of at most 5 MB
+// @Tags         images
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        image    formData	file  true  "Picture"
+// @Success      201  {object}  models.Image
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      413
+// @Failure      415
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /images [post]
+func (ih *ImageHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, models.ImageMaxSize+multipartOverhead)
+
+	file, _, err := r.FormFile(imageFormField)
+	if err != nil {
+		ih.writeError(w, err, "can`t read image from form")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.ImageMaxSize+1))
+	if err != nil {
+		ih.writeError(w, err, "can`t read image from form")
+		return
+	}
+
+	img, err := ih.ImageService.Upload(data)
+	if err != nil {
+		ih.writeError(w, err, "can`t upload image")
+		return
+	}
+
+	resp, err := json.Marshal(img)
+	if err != nil {
+		ih.Logger.Errorw("can`t marshal image",
+			"err:", err.Error())
+		http.Error(w, "can`t make image", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		ih.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get an image
+// @Description  Without variant the original upload is returned
+// @Tags         images
+// @Produce      image/jpeg,image/png,image/gif
+// @Param        IMAGE_ID    path	integer  true  "ID of image"
+// @Param        variant    query	string  false  "Resized variant thumb|card|full"
+// @Success      200  {file}  binary
+// @Header       200  {string}  Cache-Control  "Images never change, so they are cached for a year"
+// @Header       200  {string}  ETag  "Tag for If-None-Match"
+// @Success      304
+// @Failure      400
+// @Failure      404
+// @Failure      500
+// @Router       /images/{IMAGE_ID} [get]
+func (ih *ImageHandler) Get(w http.ResponseWriter, r *http.Request) {
+	imageID, err := strconv.Atoi(mux.Vars(r)["IMAGE_ID"])
+	if err != nil {
+		ih.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		ih.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	imageParams := new(models.ImageParams)
+	err = schema.NewDecoder().Decode(imageParams, r.Form)
+	if err != nil {
+		ih.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(imageParams)
+	if err != nil {
+		ih.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		contentType string
+		size        int
+		content     io.ReadCloser
+	)
+
+	etag := `"` + strconv.Itoa(imageID) + `"`
+
+	if imageParams.Variant == "" {
+		var img models.Image
+		img, content, err = ih.ImageService.Open(imageID)
+		contentType, size = img.ContentType, img.Size
+	} else {
+		var variant models.ImageVariant
+		variant, content, err = ih.ImageService.OpenVariant(imageID, imageParams.Variant)
+		contentType, size = variant.ContentType, variant.Size
+		etag = `"` + strconv.Itoa(imageID) + "-" + imageParams.Variant + `"`
+	}
+	if err != nil {
+		ih.writeError(w, err, "can`t get image")
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Cache-Control", imageCacheControl)
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = io.Copy(w, content)
+	if err != nil {
+		ih.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		return
+	}
+}
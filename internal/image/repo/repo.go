@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type PgImageRepo struct {
+	Logger logger.Logger
+	DB     *sqlx.DB
+}
+
+// Create adds the image together with its variants.
+func (pir *PgImageRepo) Create(image models.Image) (int, error) {
+	tx, err := pir.DB.Beginx()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	var id int
+
+	err = tx.QueryRow(
+		"insert into Image (content_type, size, width, height, blob_key) "+
+			"values ($1, $2, $3, $4, $5) "+
+			"returning id",
+		image.ContentType,
+		image.Size,
+		image.Width,
+		image.Height,
+		image.BlobKey,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t insert to db")
+	}
+
+	for _, variant := range image.Variants {
+		_, err = tx.Exec(
+			"insert into ImageVariant (image_id, variant, content_type, size, width, height, blob_key) "+
+				"values ($1, $2, $3, $4, $5, $6, $7)",
+			id,
+			variant.Variant,
+			variant.ContentType,
+			variant.Size,
+			variant.Width,
+			variant.Height,
+			variant.BlobKey)
+		if err != nil {
+			return 0, errors.Wrap(err, "can`t insert variant to db")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return id, nil
+}
+
+func (pir *PgImageRepo) Get(id int) (models.Image, error) {
+	image := models.Image{}
+
+	err := pir.DB.Get(
+		&image,
+		"select * "+
+			"from Image "+
+			"where id = $1",
+		id)
+	if err != nil {
+		return image, errors.Wrap(err, "can`t get from db")
+	}
+
+	image.Variants = []models.ImageVariant{}
+
+	err = pir.DB.Select(
+		&image.Variants,
+		"select * "+
+			"from ImageVariant "+
+			"where image_id = $1 "+
+			"order by width desc",
+		id)
+	if err != nil {
+		return image, errors.Wrap(err, "can`t get variants from db")
+	}
+
+	return image, nil
+}
+
+func (pir *PgImageRepo) Exists(id int) (bool, error) {
+	var exists bool
+
+	err := pir.DB.Get(
+		&exists,
+		"select exists(select 1 from Image where id = $1)",
+		id)
+	if err != nil {
+		return false, errors.Wrap(err, "can`t get from db")
+	}
+
+	return exists, nil
+}
+
+func (pir *PgImageRepo) GetVariant(id int, variant string) (models.ImageVariant, error) {
+	imageVariant := models.ImageVariant{}
+
+	err := pir.DB.Get(
+		&imageVariant,
+		"select * "+
+			"from ImageVariant "+
+			"where image_id = $1 and variant = $2",
+		id,
+		variant)
+	if err != nil {
+		return imageVariant, errors.Wrap(err, "can`t get from db")
+	}
+
+	return imageVariant, nil
+}
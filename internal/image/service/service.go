@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/blobstore"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/resize"
+	"github.com/pkg/errors"
+)
+
+const (
+	variantJPEGQuality = 85
+
+	// maxDecodes bounds how many uploads are decoded and resized at once,
+	// each of them taking up to the memory models.ImageMaxPixels allows.
+	maxDecodes = 2
+)
+
+var decodeSlots = make(chan struct{}, maxDecodes)
+
+type ImageRepo interface {
+	Create(models.Image) (int, error)
+	Get(int) (models.Image, error)
+	Exists(int) (bool, error)
+	GetVariant(int, string) (models.ImageVariant, error)
+}
+
+type ImageService struct {
+	ImageRepo ImageRepo
+	Store     blobstore.Store
+	Logger    logger.Logger
+}
+
+func newBlobKey() (string, error) {
+	key := make([]byte, 16)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", errors.Wrap(err, "can`t generate blob key")
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// makeVariants scales the picture to every variant size. Photos stay JPEG,
+// the rest become PNG to keep transparency.
+func makeVariants(picture image.Image, format, key string) ([]models.ImageVariant, [][]byte, error) {
+	variants := []models.ImageVariant{}
+	contents := [][]byte{}
+
+	for _, size := range models.ImageVariantSizes {
+		bounds := picture.Bounds()
+		w, h := resize.Fit(bounds.Dx(), bounds.Dy(), size.MaxSide)
+		if w != bounds.Dx() || h != bounds.Dy() {
+			picture = resize.Resize(picture, w, h)
+		}
+
+		var buf bytes.Buffer
+		variant := models.ImageVariant{
+			Variant: size.Name,
+			Width:   w,
+			Height:  h,
+		}
+
+		var err error
+		if format == "jpeg" {
+			variant.ContentType = models.ImageFormats["jpeg"]
+			variant.BlobKey = key + "-" + size.Name + ".jpeg"
+			err = jpeg.Encode(&buf, picture, &jpeg.Options{Quality: variantJPEGQuality})
+		} else {
+			variant.ContentType = models.ImageFormats["png"]
+			variant.BlobKey = key + "-" + size.Name + ".png"
+			err = png.Encode(&buf, picture)
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "can`t encode %s variant", size.Name)
+		}
+
+		variant.Size = buf.Len()
+		variants = append(variants, variant)
+		contents = append(contents, buf.Bytes())
+	}
+
+	return variants, contents, nil
+}
+
+// decodeVariants decodes the picture and makes its variants, waiting while
+// maxDecodes other uploads are at it.
+func decodeVariants(data []byte, format, key string) ([]models.ImageVariant, [][]byte, error) {
+	decodeSlots <- struct{}{}
+	defer func() { <-decodeSlots }()
+
+	picture, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, errors.Wrap(models.ErrBadImage, err.Error())
+	}
+
+	return makeVariants(picture, format, key)
+}
+
+func (is ImageService) deleteBlobs(keys []string) {
+	for _, key := range keys {
+		err := is.Store.Delete(key)
+		if err != nil {
+			is.Logger.Errorw("can`t delete orphaned blob",
+				"key", key,
+				"err:", err.Error())
+		}
+	}
+}
+
+// Upload checks that data is a picture of an allowed format and size by its
+// content, not by the name or type the client sent, and stores it along
+// with its resized variants.
+func (is ImageService) Upload(data []byte) (models.Image, error) {
+	if len(data) > models.ImageMaxSize {
+		return models.Image{}, errors.Wrapf(models.ErrImageTooLarge, "%d bytes", len(data))
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return models.Image{}, errors.Wrap(models.ErrBadImage, err.Error())
+	}
+
+	contentType, ok := models.ImageFormats[format]
+	if !ok {
+		return models.Image{}, errors.Wrapf(models.ErrBadImage, "format %s", format)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > models.ImageMaxPixels {
+		return models.Image{}, errors.Wrapf(models.ErrImageTooLarge, "%dx%d pixels", config.Width, config.Height)
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		return models.Image{}, err
+	}
+
+	variants, contents, err := decodeVariants(data, format, key)
+	if err != nil {
+		return models.Image{}, err
+	}
+
+	img := models.Image{
+		ContentType: contentType,
+		Size:        len(data),
+		Width:       config.Width,
+		Height:      config.Height,
+		BlobKey:     key + "." + format,
+		Variants:    variants,
+	}
+
+	stored := []string{}
+
+	err = is.Store.Put(img.BlobKey, bytes.NewReader(data))
+	if err != nil {
+		return models.Image{}, errors.Wrap(err, "can`t put to store")
+	}
+	stored = append(stored, img.BlobKey)
+
+	for i, variant := range variants {
+		err = is.Store.Put(variant.BlobKey, bytes.NewReader(contents[i]))
+		if err != nil {
+			is.deleteBlobs(stored)
+			return models.Image{}, errors.Wrap(err, "can`t put variant to store")
+		}
+		stored = append(stored, variant.BlobKey)
+	}
+
+	img.ID, err = is.ImageRepo.Create(img)
+	if err != nil {
+		is.deleteBlobs(stored)
+		return models.Image{}, errors.Wrap(err, "can`t add to repo")
+	}
+
+	return is.Get(img.ID)
+}
+
+func (is ImageService) Get(id int) (models.Image, error) {
+	img, err := is.ImageRepo.Get(id)
+	if err != nil {
+		return models.Image{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	img.URL = models.ImageURL(img.ID)
+	for i := range img.Variants {
+		img.Variants[i].URL = models.ImageVariantURL(img.ID, img.Variants[i].Variant)
+	}
+
+	return img, nil
+}
+
+// Check makes sure the image with the id was uploaded, so that items and
+// brands don`t point at pictures that don`t exist. 0 stands for no image.
+func (is ImageService) Check(id int) error {
+	if id == 0 {
+		return nil
+	}
+
+	exists, err := is.ImageRepo.Exists(id)
+	if err != nil {
+		return errors.Wrap(err, "can`t get from repo")
+	}
+
+	if !exists {
+		return errors.Wrapf(models.ErrNoImage, "image %d", id)
+	}
+
+	return nil
+}
+
+// Open returns the image together with its content, which the caller closes.
+func (is ImageService) Open(id int) (models.Image, io.ReadCloser, error) {
+	img, err := is.Get(id)
+	if err != nil {
+		return models.Image{}, nil, err
+	}
+
+	content, err := is.Store.Open(img.BlobKey)
+	if err != nil {
+		return models.Image{}, nil, errors.Wrap(err, "can`t open from store")
+	}
+
+	return img, content, nil
+}
+
+// OpenVariant returns one resized variant of the image together with its
+// content, which the caller closes.
+func (is ImageService) OpenVariant(id int, variant string) (models.ImageVariant, io.ReadCloser, error) {
+	imageVariant, err := is.ImageRepo.GetVariant(id, variant)
+	if err != nil {
+		return models.ImageVariant{}, nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	content, err := is.Store.Open(imageVariant.BlobKey)
+	if err != nil {
+		return models.ImageVariant{}, nil, errors.Wrap(err, "can`t open from store")
+	}
+
+	return imageVariant, content, nil
+}
@@ -1,6 +1,8 @@
 package delivery
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -8,24 +10,56 @@ import (
 
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
+	"github.com/pkg/errors"
 )
 
 type ItemService interface {
-	Create(models.Item) (int, error)
+	Create(models.Item, int, string) (int, error)
 	Get(int) (models.Item, error)
-	Patch(int, models.ItemsPatchPrice) error
-	GetAll(models.ItemsParams) ([]models.Item, error)
-	Update(models.Item) (models.Item, error)
-	Delete(int) error
+	Patch(int, models.ItemsPatchPrice, int, string) error
+	PatchStock(int, models.ItemsPatchStock) error
+	GetAll(models.ItemsParams) ([]models.Item, models.PageInfo, error)
+	GetFacets(models.ItemsParams) (models.ItemsFacets, error)
+	Update(models.Item, int, string) (models.Item, error)
+	Delete(int, int, string) error
+}
+
+type ContextManager interface {
+	UserIDFromContext(ctx context.Context) (int, error)
+	UserRoleFromContext(ctx context.Context) (string, error)
 }
 
 type ItemHandler struct {
-	ItemService ItemService
-	Logger      logger.Logger
+	ItemService    ItemService
+	ContextManager ContextManager
+	Logger         logger.Logger
+}
+
+// user reads the id and the role of the authorized user, writing the error
+// response when they are missing.
+func (ih *ItemHandler) user(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	userID, err := ih.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		ih.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+
+	userRole, err := ih.ContextManager.UserRoleFromContext(r.Context())
+	if err != nil {
+		ih.Logger.Errorw("fail to get role from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+
+	return userID, userRole, true
 }
 
 // @Summary      Get an information about item
@@ -55,6 +89,12 @@ func (ih *ItemHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	item, err := ih.ItemService.Get(itemId)
+	if errors.Is(err, sql.ErrNoRows) {
+		ih.Logger.Infow("can`t get item",
+			"err:", err.Error())
+		http.Error(w, "no such item", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		ih.Logger.Infow("can`t get item",
 			"err:", err.Error())
@@ -86,13 +126,25 @@ func (ih *ItemHandler) Get(w http.ResponseWriter, r *http.Request) {
 // @Tags         items
 // @Accept       json
 // @Produce      json
-// @Param        Page_size    query	integer  true  "Size of page"
-// @Param        Page_num    query	integer  true  "Number of page"
+// @Param        Page_size    query	integer  false  "Size of page, 20 by default, at most 100"
+// @Param        Page_num    query	integer  false  "Number of page, starting from 1"
+// @Param        cursor    query	string  false  "Next page cursor from next_cursor or X-Next-Cursor"
+// @Param        with_total    query	boolean  false  "Count all matching items into total and X-Total-Count"
 // @Param        WhereCategory    query	string  false  "Category ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа|any"
 // @Param        WhereSex    query	string  false  "Sex male|female|any"
 // @Param        WhereBrand    query	integer  false  "Brnad"
-// @Param        OrderBy    query	string  false  "Price asc|desc|any"
-// @Success      200  {array}  models.Item
+// @Param        q    query	string  false  "Search in title, description, category and brand name"
+// @Param        WhereCategories    query	[]string  false  "Several categories, repeat the parameter"  collectionFormat(multi)
+// @Param        WhereBrands    query	[]integer  false  "Several brands, repeat the parameter"  collectionFormat(multi)
+// @Param        WhereSizes    query	[]string  false  "Sizes XS|S|M|L|XL|XXL, repeat the parameter"  collectionFormat(multi)
+// @Param        PriceMin    query	integer  false  "Lowest price"
+// @Param        PriceMax    query	integer  false  "Highest price"
+// @Param        InStock    query	boolean  false  "Only items that can be bought now"
+// @Param        OrderBy    query	string  false  "Price asc|desc, rating (best rated first) or any"
+// @Success      200  {object}  models.ItemsPage
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, absent on the last one"
+// @Header       200  {integer}  X-Total-Count  "Number of matching items, with with_total only"
+// @Header       200  {string}  Link  "Next page, rel=next"
 // @Failure      400
 // @Failure      404
 // @Failure      500
@@ -123,7 +175,7 @@ func (ih *ItemHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	items, err := ih.ItemService.GetAll(*itemsParams)
+	items, page, err := ih.ItemService.GetAll(*itemsParams)
 	if err != nil {
 		ih.Logger.Infow("can`t get items",
 			"err:", err.Error())
@@ -131,7 +183,7 @@ func (ih *ItemHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := json.Marshal(items)
+	resp, err := json.Marshal(models.ItemsPage{Items: items, PageInfo: page})
 
 	if err != nil {
 		ih.Logger.Errorw("can`t marshal items",
@@ -140,6 +192,80 @@ func (ih *ItemHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pagination.WriteHeaders(w, r, page.NextCursor, page.Total)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		ih.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Count items per category, size, sex, brand and price range
+// @Description  Each facet ignores its own filter, so the counts show what choosing another value would give
+// @Tags         items
+// @Accept       json
+// @Produce      json
+// @Param        WhereCategory    query	string  false  "Category ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа|any"
+// @Param        WhereSex    query	string  false  "Sex male|female|any"
+// @Param        WhereBrand    query	integer  false  "Brand"
+// @Param        q    query	string  false  "Search in title, description, category and brand name"
+// @Param        WhereCategories    query	[]string  false  "Several categories, repeat the parameter"  collectionFormat(multi)
+// @Param        WhereBrands    query	[]integer  false  "Several brands, repeat the parameter"  collectionFormat(multi)
+// @Param        WhereSizes    query	[]string  false  "Sizes XS|S|M|L|XL|XXL, repeat the parameter"  collectionFormat(multi)
+// @Param        PriceMin    query	integer  false  "Lowest price"
+// @Param        PriceMax    query	integer  false  "Highest price"
+// @Param        InStock    query	boolean  false  "Only items that can be bought now"
+// @Success      200  {object}  models.ItemsFacets
+// @Failure      400
+// @Failure      500
+// @Router       /items/facets [get]
+func (ih *ItemHandler) GetFacets(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		ih.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	itemsParams := new(models.ItemsParams)
+	err = schema.NewDecoder().Decode(itemsParams, r.Form)
+	if err != nil {
+		ih.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(itemsParams)
+	if err != nil {
+		ih.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	facets, err := ih.ItemService.GetFacets(*itemsParams)
+	if err != nil {
+		ih.Logger.Infow("can`t get facets",
+			"err:", err.Error())
+		http.Error(w, "can`t get facets", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(facets)
+
+	if err != nil {
+		ih.Logger.Errorw("can`t marshal facets",
+			"err:", err.Error())
+		http.Error(w, "can`t make facets", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 
 	_, err = w.Write(resp)
@@ -157,6 +283,8 @@ func (ih *ItemHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param 		 item_model body models.Item true "new item"
 // @Success      200
+// @Failure      401
+// @Failure      403
 // @Failure      404
 // @Failure      500
 // @Security ApiKeyAuth
@@ -189,7 +317,30 @@ func (ih *ItemHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item.ID, err = ih.ItemService.Create(*item)
+	userID, userRole, ok := ih.user(w, r)
+	if !ok {
+		return
+	}
+
+	item.ID, err = ih.ItemService.Create(*item, userID, userRole)
+	if errors.Is(err, models.ErrForbidden) {
+		ih.Logger.Infow("can`t create item",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrNoBrand) {
+		ih.Logger.Infow("can`t create item",
+			"err:", err.Error())
+		http.Error(w, "no such brand", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrNoImage) {
+		ih.Logger.Infow("can`t create item",
+			"err:", err.Error())
+		http.Error(w, "no such image", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		ih.Logger.Infow("can`t create item",
 			"err:", err.Error())
@@ -226,6 +377,7 @@ func (ih *ItemHandler) Create(w http.ResponseWriter, r *http.Request) {
 // @Success      200
 // @Failure      400
 // @Failure      401
+// @Failure      403
 // @Failure      404
 // @Failure      500
 // @Security ApiKeyAuth
@@ -273,8 +425,31 @@ func (ih *ItemHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, userRole, ok := ih.user(w, r)
+	if !ok {
+		return
+	}
+
 	item.ID = itemId
-	*item, err = ih.ItemService.Update(*item)
+	*item, err = ih.ItemService.Update(*item, userID, userRole)
+	if errors.Is(err, models.ErrForbidden) {
+		ih.Logger.Infow("can`t update item",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrNoBrand) {
+		ih.Logger.Infow("can`t update item",
+			"err:", err.Error())
+		http.Error(w, "no such brand", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrNoImage) {
+		ih.Logger.Infow("can`t update item",
+			"err:", err.Error())
+		http.Error(w, "no such image", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		ih.Logger.Infow("can`t update item",
 			"err:", err.Error())
@@ -309,6 +484,7 @@ func (ih *ItemHandler) Update(w http.ResponseWriter, r *http.Request) {
 // @Param        ITEM_ID    path	integer  true  "ID of deleting item"
 // @Success      200
 // @Failure      401
+// @Failure      403
 // @Failure      404
 // @Failure      500
 // @Security ApiKeyAuth
@@ -330,7 +506,18 @@ func (ih *ItemHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = ih.ItemService.Delete(itemId)
+	userID, userRole, ok := ih.user(w, r)
+	if !ok {
+		return
+	}
+
+	err = ih.ItemService.Delete(itemId, userID, userRole)
+	if errors.Is(err, models.ErrForbidden) {
+		ih.Logger.Infow("can`t delete item",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		ih.Logger.Infow("can`t delete item",
 			"err:", err.Error())
@@ -350,6 +537,7 @@ func (ih *ItemHandler) Delete(w http.ResponseWriter, r *http.Request) {
 // @Success      200
 // @Failure      400
 // @Failure      401
+// @Failure      403
 // @Failure      404
 // @Failure      500
 // @Security ApiKeyAuth
@@ -397,7 +585,18 @@ func (ih *ItemHandler) Patch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = ih.ItemService.Patch(itemId, *PatchItem)
+	userID, userRole, ok := ih.user(w, r)
+	if !ok {
+		return
+	}
+
+	err = ih.ItemService.Patch(itemId, *PatchItem, userID, userRole)
+	if errors.Is(err, models.ErrForbidden) {
+		ih.Logger.Infow("can`t Patch item",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		ih.Logger.Infow("can`t Patch item",
 			"err:", err.Error())
@@ -407,3 +606,83 @@ func (ih *ItemHandler) Patch(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// @Summary      Set items stock
+// @Tags         items
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "Id of the item"
+// @Param 		 item_stock body models.ItemsPatchStock true "New stock"
+// @Success      200
+// @Failure      400
+// @Failure      401
+// @Failure      404
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /items/{ITEM_ID}/stock [patch]
+func (ih *ItemHandler) PatchStock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemIdString, ok := vars["ITEM_ID"]
+	if !ok {
+		ih.Logger.Errorw("no ITEM_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	itemId, err := strconv.Atoi(itemIdString)
+	if err != nil {
+		ih.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	patchStock := &models.ItemsPatchStock{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		ih.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, patchStock)
+	if err != nil {
+		ih.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(patchStock)
+	if err != nil {
+		ih.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = ih.ItemService.PatchStock(itemId, *patchStock)
+	if errors.Is(err, sql.ErrNoRows) {
+		ih.Logger.Infow("can`t patch item stock",
+			"err:", err.Error())
+		http.Error(w, "no such item", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrOutOfStock) {
+		ih.Logger.Infow("can`t patch item stock",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		ih.Logger.Infow("can`t patch item stock",
+			"err:", err.Error())
+		http.Error(w, "can`t patch item stock", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,11 +1,16 @@
 package repo
 
 import (
-	"fmt"
+	"database/sql"
+	"strconv"
+	"strings"
 
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
+	"github.com/el1ljah/cp_db/pkg/querybuilder"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -18,8 +23,8 @@ func (pir *PgItemRepo) Create(item models.Item) (int, error) {
 	var id int
 
 	err := pir.DB.QueryRow(
-		"insert into Item "+
-			"values ((select max(id) from Item) + 1, $1, $2, $3, $4, $5, $6, $7) "+
+		"insert into Item (id, category, size, price, sex, image_id, brand_id, is_available, stock, title, description) "+
+			"values ((select max(id) from Item) + 1, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10) "+
 			"returning id",
 		item.Category,
 		item.Size,
@@ -28,6 +33,9 @@ func (pir *PgItemRepo) Create(item models.Item) (int, error) {
 		item.ImageID,
 		item.BrandID,
 		item.IsAvailable,
+		item.Stock,
+		item.Title,
+		item.Description,
 	).Scan(&id)
 	if err != nil {
 		return 0, errors.Wrap(err, "can`t insert to db")
@@ -36,14 +44,28 @@ func (pir *PgItemRepo) Create(item models.Item) (int, error) {
 	return id, nil
 }
 
+// itemColumns are the columns of models.Item, leaving out the search vector.
+const itemColumns = "i.id, i.category, i.size, i.price, i.sex, i.image_id, i.brand_id, i.is_available, " +
+	"i.stock, i.reserved, i.rating, i.review_count, i.title, i.description"
+
+// itemHasImage tells whether the image of the item was uploaded, since items
+// from the seed data point at pictures that were never stored, and
+// itemImageVariants lists the variants made of it.
+const (
+	itemHasImage      = "exists(select 1 from Image im where im.id = i.image_id) as has_image"
+	itemImageVariants = "array(select v.variant from ImageVariant v where v.image_id = i.image_id) as image_variant_names"
+)
+
+// Get doesn`t find items of archived brands, which listings leave out too.
 func (pir *PgItemRepo) Get(id int) (models.Item, error) {
 	item := models.Item{}
 
 	err := pir.DB.Get(
 		&item,
-		"select * "+
-			"from Item "+
-			"where id = $1",
+		"select "+itemColumns+", "+itemHasImage+", "+itemImageVariants+" "+
+			"from Item i "+
+			"join Brand b on b.id = i.brand_id "+
+			"where i.id = $1 and not b.archived",
 		id)
 	if err != nil {
 		return item, errors.Wrap(err, "can`t get from db")
@@ -52,52 +74,134 @@ func (pir *PgItemRepo) Get(id int) (models.Item, error) {
 	return item, nil
 }
 
-func (pir *PgItemRepo) genGetAllQuery(params models.ItemsParams) string {
-	base := "select * from Item"
-	conds := []string{}
+// itemSearchVector weights item title over category and brand name, and
+// those over description, so ts_rank orders results by relevance. Triggers
+// on Item and Brand keep it up to date, and a GIN index serves the matches.
+const itemSearchVector = "i.search_vector"
 
-	if params.WhereBrand > 0 {
-		conds = append(conds, fmt.Sprintf("brand_id = %d", params.WhereBrand))
+// itemsSelect starts a query over items joined with their brand, narrowed by
+// every filter except the ones of the given facet. Items of archived brands
+// are left out.
+func itemsSelect(filters []itemFilter, facet string, columns ...string) *querybuilder.SelectBuilder {
+	sb := querybuilder.Select(columns...).
+		From("Item i").
+		Join("left join Brand b on b.id = i.brand_id").
+		Where("not coalesce(b.archived, false)")
+
+	for _, filter := range filters {
+		if filter.facet != "" && filter.facet == facet {
+			continue
+		}
+
+		sb.Where(filter.cond, filter.args...)
 	}
-	if params.WhereCategory != models.ItemsParamsAny && params.WhereCategory != ""{
-		conds = append(conds, fmt.Sprintf("category = '%s'", params.WhereCategory))
+
+	return sb
+}
+
+// itemSortKey is a keyset column together with the way to read its value
+// from the last item of a page.
+type itemSortKey struct {
+	querybuilder.SortKey
+	value func(models.Item) interface{}
+}
+
+var (
+	itemKeyID          = itemSortKey{querybuilder.SortKey{Expr: "i.id"}, func(item models.Item) interface{} { return item.ID }}
+	itemKeyPrice       = itemSortKey{querybuilder.SortKey{Expr: "i.price"}, func(item models.Item) interface{} { return item.Price }}
+	itemKeyPriceDesc   = itemSortKey{querybuilder.SortKey{Expr: "i.price", Desc: true}, itemKeyPrice.value}
+	itemKeyRating      = itemSortKey{querybuilder.SortKey{Expr: "i.rating", Desc: true}, func(item models.Item) interface{} { return item.Rating }}
+	itemKeyReviewCount = itemSortKey{querybuilder.SortKey{Expr: "i.review_count", Desc: true}, func(item models.Item) interface{} { return item.ReviewCount }}
+)
+
+const itemsOrderRelevance = "relevance"
+
+// itemOrderBy names the ordering the items are listed in. Searches without
+// an explicit order are ranked by relevance.
+func itemOrderBy(params models.ItemsParams) string {
+	switch {
+	case params.Q != "" && (params.OrderBy == models.ItemsParamsAny || params.OrderBy == ""):
+		return itemsOrderRelevance
+	case params.OrderBy == "":
+		return models.ItemsOrderAsc
+	default:
+		return params.OrderBy
 	}
-	if params.WhereSex != models.ItemsParamsAny && params.WhereSex != "" {
-		conds = append(conds, fmt.Sprintf("sex = '%s'", params.WhereSex))
+}
+
+// itemSortKeys returns the keyset for the ordering, always ending with the id
+// so that it is unique. Relevance ordering has no keyset, since the rank is
+// computed, and is paginated by offset.
+func itemSortKeys(orderBy string) []itemSortKey {
+	switch orderBy {
+	case itemsOrderRelevance:
+		return nil
+	case models.ItemsOrderRating:
+		return []itemSortKey{itemKeyRating, itemKeyReviewCount, itemKeyID}
+	case models.ItemsOrderDesc:
+		return []itemSortKey{itemKeyPriceDesc, itemKeyID}
+	case models.ItemsParamsAny:
+		return []itemSortKey{itemKeyID}
+	default:
+		return []itemSortKey{itemKeyPrice, itemKeyID}
 	}
+}
 
-	if len(conds) != 0 {
-		base += " where"
+func (pir *PgItemRepo) genGetAllQuery(params models.ItemsParams, orderBy string, keys []itemSortKey) (string, []interface{}, int, error) {
+	sb := itemsSelect(itemFilters(params), "", itemColumns, itemHasImage, itemImageVariants)
+	offset := 0
 
-		for i := 0; i < len(conds)-1; i++ {
-			base += " " + conds[i] + "and"
+	cursor := pagination.Cursor{}
+	if params.Cursor != "" {
+		var err error
+
+		cursor, err = pagination.DecodeKeys(params.Cursor, orderBy, "", len(keys))
+		if err != nil {
+			return "", nil, 0, err
 		}
+	}
 
-		base += " " + conds[len(conds)-1]
+	sortKeys := make([]querybuilder.SortKey, 0, len(keys))
+	for _, key := range keys {
+		sortKeys = append(sortKeys, key.SortKey)
 	}
 
-	if params.OrderBy != models.ItemsParamsAny {
-		base += " order by price"
+	if keys == nil {
+		sb.OrderBy("ts_rank("+itemSearchVector+", websearch_to_tsquery('russian', ?)) desc", params.Q).
+			OrderBy("i.id")
+		offset = cursor.Offset
+	} else {
+		sb.After(sortKeys, cursor.Values).OrderByKeys(sortKeys...)
+	}
 
-		if params.OrderBy == models.ItemsOrderDesc {
-			base += " desc"
-		}
+	if params.Cursor == "" && params.Page_num > 1 {
+		offset = (params.Page_num - 1) * params.Page_size
 	}
-	base += fmt.Sprintf(" limit %d offset %d", params.Page_size, params.Page_num)
 
-	
+	query, args := sb.Limit(params.Page_size + 1).Offset(offset).Build()
 
-	return base
+	return query, args, offset, nil
 }
 
-func (pir *PgItemRepo) GetAll(params models.ItemsParams) ([]models.Item, error) {
-	query := pir.genGetAllQuery(params)
-	pir.Logger.Debugw("PgItemRepo.GetAll()", "query", query)
-	rows, err := pir.DB.Queryx(query)
+// GetAll returns one page of items and the cursor of the next page, empty on
+// the last one.
+func (pir *PgItemRepo) GetAll(params models.ItemsParams) ([]models.Item, string, error) {
+	orderBy := itemOrderBy(params)
+	keys := itemSortKeys(orderBy)
+
+	query, args, offset, err := pir.genGetAllQuery(params, orderBy, keys)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pir.Logger.Debugw("PgItemRepo.GetAll()", "query", query, "args", args)
+	rows, err := pir.DB.Queryx(query, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "can`t get from db, query: "+query)
+		return nil, "", errors.Wrap(err, "can`t get from db, query: "+query)
 	}
 
+	defer rows.Close()
+
 	items := []models.Item{}
 
 	for rows.Next() {
@@ -105,13 +209,40 @@ func (pir *PgItemRepo) GetAll(params models.ItemsParams) ([]models.Item, error)
 
 		err := rows.StructScan(&item)
 		if err != nil {
-			return nil, errors.Wrap(err, "can`t scan struct from db query result")
+			return nil, "", errors.Wrap(err, "can`t scan struct from db query result")
 		}
 
 		items = append(items, item)
 	}
 
-	return items, nil
+	if len(items) <= params.Page_size {
+		return items, "", nil
+	}
+
+	items = items[:params.Page_size]
+	last := items[len(items)-1]
+
+	cursor := pagination.Cursor{OrderBy: orderBy, Offset: offset + params.Page_size}
+	if keys != nil {
+		cursor.Offset = 0
+		for _, key := range keys {
+			cursor.Values = append(cursor.Values, key.value(last))
+		}
+	}
+
+	return items, pagination.Encode(cursor), nil
+}
+
+func (pir *PgItemRepo) Count(params models.ItemsParams) (int, error) {
+	var total int
+
+	query, args := itemsSelect(itemFilters(params), "", "i.id").BuildCount()
+	err := pir.DB.Get(&total, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t count in db")
+	}
+
+	return total, nil
 }
 
 func (pir *PgItemRepo) Update(item models.Item) (models.Item, error) {
@@ -123,8 +254,10 @@ func (pir *PgItemRepo) Update(item models.Item) (models.Item, error) {
 			"sex = $4, "+
 			"image_id = $5, "+
 			"brand_id = $6, "+
-			"is_available = $7 "+
-			"where id = $8",
+			"is_available = $7, "+
+			"title = $8, "+
+			"description = $9 "+
+			"where id = $10",
 		item.Category,
 		item.Size,
 		item.Price,
@@ -132,6 +265,8 @@ func (pir *PgItemRepo) Update(item models.Item) (models.Item, error) {
 		item.ImageID,
 		item.BrandID,
 		item.IsAvailable,
+		item.Title,
+		item.Description,
 		item.ID)
 	if err != nil {
 		return item, errors.Wrap(err, "can`t update table in db")
@@ -153,6 +288,44 @@ func (pir *PgItemRepo) Patch(itemID int, price int) error {
 	return nil
 }
 
+// PatchStock refuses to set the stock below the units held in baskets, which
+// would let those baskets commit stock that doesn`t exist.
+func (pir *PgItemRepo) PatchStock(itemID int, stock int) error {
+	res, err := pir.DB.Exec(
+		"update Item "+
+			"set stock = $1 "+
+			"where id = $2 and reserved <= $1",
+		stock,
+		itemID)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	var reserved int
+
+	err = pir.DB.Get(&reserved,
+		"select reserved "+
+			"from Item "+
+			"where id = $1",
+		itemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrapf(err, "no item %d", itemID)
+	} else if err != nil {
+		return errors.Wrap(err, "can`t get from db")
+	}
+
+	return errors.Wrapf(models.ErrOutOfStock, "%d units of item %d are reserved", reserved, itemID)
+}
+
 func (pir *PgItemRepo) Delete(id int) error {
 	_, err := pir.DB.Exec(
 		"delete from Item "+
@@ -164,3 +337,159 @@ func (pir *PgItemRepo) Delete(id int) error {
 
 	return nil
 }
+
+const (
+	facetCategory = "category"
+	facetSize     = "size"
+	facetSex      = "sex"
+	facetBrand    = "brand"
+	facetPrice    = "price"
+)
+
+// itemFilter is a where condition with "?" placeholders, tagged with the
+// facet it narrows so that the facet's own counts can ignore it.
+type itemFilter struct {
+	facet string
+	cond  string
+	args  []interface{}
+}
+
+func itemFilters(params models.ItemsParams) []itemFilter {
+	filters := []itemFilter{}
+
+	if params.Q != "" {
+		filters = append(filters, itemFilter{
+			cond: itemSearchVector + " @@ websearch_to_tsquery('russian', ?)",
+			args: []interface{}{params.Q},
+		})
+	}
+
+	brands := params.WhereBrands
+	if params.WhereBrand > 0 {
+		brands = append(brands, params.WhereBrand)
+	}
+	if len(brands) != 0 {
+		filters = append(filters, itemFilter{facetBrand, "i.brand_id = any(?)", []interface{}{pq.Array(brands)}})
+	}
+
+	categories := params.WhereCategories
+	if params.WhereCategory != models.ItemsParamsAny && params.WhereCategory != "" {
+		categories = append(categories, params.WhereCategory)
+	}
+	if len(categories) != 0 {
+		filters = append(filters, itemFilter{facetCategory, "i.category = any(?)", []interface{}{pq.Array(categories)}})
+	}
+
+	if len(params.WhereSizes) != 0 {
+		filters = append(filters, itemFilter{facetSize, "i.size = any(?)", []interface{}{pq.Array(params.WhereSizes)}})
+	}
+	if params.WhereSex != models.ItemsParamsAny && params.WhereSex != "" {
+		filters = append(filters, itemFilter{facetSex, "i.sex = ?", []interface{}{params.WhereSex}})
+	}
+
+	if params.PriceMin > 0 {
+		filters = append(filters, itemFilter{facetPrice, "i.price >= ?", []interface{}{params.PriceMin}})
+	}
+	if params.PriceMax > 0 {
+		filters = append(filters, itemFilter{facetPrice, "i.price <= ?", []interface{}{params.PriceMax}})
+	}
+
+	if params.InStock {
+		filters = append(filters, itemFilter{cond: "i.is_available and i.stock - i.reserved > 0"})
+	}
+
+	return filters
+}
+
+func (pir *PgItemRepo) facetCounts(filters []itemFilter, facet, value, label string) ([]models.FacetCount, error) {
+	query, args := itemsSelect(filters, facet, value+" as value", label+" as label", "count(*) as count").
+		GroupBy("1", "2").
+		OrderBy("count desc").
+		OrderBy("value").
+		Build()
+
+	counts := []models.FacetCount{}
+
+	err := pir.DB.Select(&counts, query, args...)
+	if err != nil {
+		return counts, errors.Wrap(err, "can`t get from db, query: "+query)
+	}
+
+	return counts, nil
+}
+
+// priceBuckets renders models.ItemsPriceBuckets as an array literal for
+// width_bucket; the bounds are constants, not user input.
+func priceBuckets() string {
+	bounds := make([]string, 0, len(models.ItemsPriceBuckets))
+	for _, bound := range models.ItemsPriceBuckets {
+		bounds = append(bounds, strconv.Itoa(bound))
+	}
+
+	return "array[" + strings.Join(bounds, ", ") + "]"
+}
+
+func (pir *PgItemRepo) GetFacets(params models.ItemsParams) (models.ItemsFacets, error) {
+	filters := itemFilters(params)
+	facets := models.ItemsFacets{}
+
+	var err error
+
+	facets.Categories, err = pir.facetCounts(filters, facetCategory, "i.category", "''")
+	if err != nil {
+		return facets, err
+	}
+
+	facets.Sizes, err = pir.facetCounts(filters, facetSize, "i.size", "''")
+	if err != nil {
+		return facets, err
+	}
+
+	facets.Sexes, err = pir.facetCounts(filters, facetSex, "i.sex", "''")
+	if err != nil {
+		return facets, err
+	}
+
+	facets.Brands, err = pir.facetCounts(filters, facetBrand, "i.brand_id::text", "coalesce(b.brand_name, '')")
+	if err != nil {
+		return facets, err
+	}
+
+	query, args := itemsSelect(filters, facetPrice, "width_bucket(i.price, "+priceBuckets()+") as bucket", "count(*) as count").
+		GroupBy("1").
+		OrderBy("1").
+		Build()
+
+	rows, err := pir.DB.Queryx(query, args...)
+	if err != nil {
+		return facets, errors.Wrap(err, "can`t get from db, query: "+query)
+	}
+	defer rows.Close()
+
+	facets.Prices = []models.PriceFacetCount{}
+
+	for rows.Next() {
+		var bucket, count int
+
+		err = rows.Scan(&bucket, &count)
+		if err != nil {
+			return facets, errors.Wrap(err, "can`t scan from db query result")
+		}
+
+		if bucket < 1 {
+			continue
+		}
+
+		price := models.PriceFacetCount{
+			From:  models.ItemsPriceBuckets[bucket-1],
+			Count: count,
+		}
+		if bucket < len(models.ItemsPriceBuckets) {
+			price.To = models.ItemsPriceBuckets[bucket]
+		}
+
+		facets.Prices = append(facets.Prices, price)
+	}
+
+	return facets, nil
+}
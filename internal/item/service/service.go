@@ -1,8 +1,11 @@
 package service
 
 import (
+	"database/sql"
+
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
 	"github.com/pkg/errors"
 )
 
@@ -10,17 +13,78 @@ type ItemRepo interface {
 	Create(models.Item) (int, error)
 	Get(int) (models.Item, error)
 	Patch(int, int) error
-	GetAll(models.ItemsParams) ([]models.Item, error)
+	PatchStock(int, int) error
+	GetAll(models.ItemsParams) ([]models.Item, string, error)
+	Count(models.ItemsParams) (int, error)
+	GetFacets(models.ItemsParams) (models.ItemsFacets, error)
 	Update(models.Item) (models.Item, error)
 	Delete(int) error
 }
 
+// BrandAccess tells whether the user may manage the items of the brands, and
+// finds brands that aren`t archived.
+type BrandAccess interface {
+	CheckAccess(userID int, role string, brandIDs ...int) error
+	Get(id int) (models.Brand, error)
+}
+
+// ImageChecker tells whether an image was uploaded.
+type ImageChecker interface {
+	Check(id int) error
+}
+
 type ItemService struct {
 	ItemRepo ItemRepo
+	Brands   BrandAccess
+	Images   ImageChecker
 	Logger   logger.Logger
 }
 
-func (is ItemService) Create(item models.Item) (int, error) {
+// checkItemAccess lets the user change the item only if they may manage its
+// brand.
+func (is ItemService) checkItemAccess(id, userID int, role string) error {
+	if role == models.UserRoleAdmin {
+		return nil
+	}
+
+	item, err := is.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return is.Brands.CheckAccess(userID, role, item.BrandID)
+}
+
+// checkBrand refuses brands that don`t exist or are archived, whose items
+// would be hidden right away.
+func (is ItemService) checkBrand(id int) error {
+	_, err := is.Brands.Get(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrapf(models.ErrNoBrand, "brand %d", id)
+	}
+	if err != nil {
+		return errors.Wrap(err, "can`t get brand")
+	}
+
+	return nil
+}
+
+func (is ItemService) Create(item models.Item, userID int, role string) (int, error) {
+	err := is.Brands.CheckAccess(userID, role, item.BrandID)
+	if err != nil {
+		return -1, err
+	}
+
+	err = is.checkBrand(item.BrandID)
+	if err != nil {
+		return -1, err
+	}
+
+	err = is.Images.Check(item.ImageID)
+	if err != nil {
+		return -1, err
+	}
+
 	id, err := is.ItemRepo.Create(item)
 	if err != nil {
 		return -1, errors.Wrap(err, "can`t add to repo")
@@ -29,8 +93,13 @@ func (is ItemService) Create(item models.Item) (int, error) {
 	return id, nil
 }
 
-func (is ItemService) Patch(id int, price models.ItemsPatchPrice) error {
-	err := is.ItemRepo.Patch(id, price.NewPrice)
+func (is ItemService) Patch(id int, price models.ItemsPatchPrice, userID int, role string) error {
+	err := is.checkItemAccess(id, userID, role)
+	if err != nil {
+		return err
+	}
+
+	err = is.ItemRepo.Patch(id, price.NewPrice)
 	if err != nil {
 		return errors.Wrap(err, "can`t get to repo")
 	}
@@ -38,35 +107,151 @@ func (is ItemService) Patch(id int, price models.ItemsPatchPrice) error {
 	return nil
 }
 
+func (is ItemService) PatchStock(id int, stock models.ItemsPatchStock) error {
+	err := is.ItemRepo.PatchStock(id, stock.NewStock)
+	if err != nil {
+		return errors.Wrap(err, "can`t update stock in repo")
+	}
+
+	return nil
+}
+
 func (is ItemService) Get(id int) (models.Item, error) {
 	item, err := is.ItemRepo.Get(id)
 	if err != nil {
 		return models.Item{}, errors.Wrap(err, "can`t get from repo")
 	}
 
+	item.SetImageURLs()
+
 	return item, nil
 }
 
-func (is ItemService) GetAll(params models.ItemsParams) ([]models.Item, error) {
-	items, err := is.ItemRepo.GetAll(params)
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkItemsParams validates the multi-value filters, which govalidator tags
+// can`t describe.
+func checkItemsParams(params models.ItemsParams) error {
+	for _, category := range params.WhereCategories {
+		if !contains(models.ItemCategories, category) {
+			return errors.Errorf("unknown category %q", category)
+		}
+	}
+
+	for _, size := range params.WhereSizes {
+		if !contains(models.ItemSizes, size) {
+			return errors.Errorf("unknown size %q", size)
+		}
+	}
+
+	for _, brand := range params.WhereBrands {
+		if brand <= 0 {
+			return errors.Errorf("bad brand id %d", brand)
+		}
+	}
+
+	if params.PriceMax > 0 && params.PriceMin > params.PriceMax {
+		return errors.Errorf("min price %d is greater than max price %d", params.PriceMin, params.PriceMax)
+	}
+
+	return nil
+}
+
+func (is ItemService) GetAll(params models.ItemsParams) ([]models.Item, models.PageInfo, error) {
+	err := checkItemsParams(params)
+	if err != nil {
+		return nil, models.PageInfo{}, errors.Wrap(err, "bad filters")
+	}
+
+	params.Page_size = pagination.Size(params.Page_size)
+
+	items, next, err := is.ItemRepo.GetAll(params)
 	if err != nil {
-		return nil, errors.Wrap(err, "can`t get from repo")
+		return nil, models.PageInfo{}, errors.Wrap(err, "can`t get from repo")
 	}
 
-	return items, nil
+	for i := range items {
+		items[i].SetImageURLs()
+	}
+
+	page := models.PageInfo{NextCursor: next}
+
+	if params.WithTotal {
+		total, err := is.ItemRepo.Count(params)
+		if err != nil {
+			return nil, models.PageInfo{}, errors.Wrap(err, "can`t count in repo")
+		}
+
+		page.Total = &total
+	}
+
+	return items, page, nil
 }
 
-func (is ItemService) Update(item models.Item) (models.Item, error) {
-	item, err := is.ItemRepo.Update(item)
+func (is ItemService) GetFacets(params models.ItemsParams) (models.ItemsFacets, error) {
+	err := checkItemsParams(params)
+	if err != nil {
+		return models.ItemsFacets{}, errors.Wrap(err, "bad filters")
+	}
+
+	facets, err := is.ItemRepo.GetFacets(params)
+	if err != nil {
+		return models.ItemsFacets{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return facets, nil
+}
+
+// Update also checks the new brand of the item, so a brand manager can`t hand
+// items over to a brand they don`t manage. An image id left as it was is
+// kept even if the picture was never uploaded, so that seeded items stay
+// editable.
+func (is ItemService) Update(item models.Item, userID int, role string) (models.Item, error) {
+	current, err := is.Get(item.ID)
+	if err != nil {
+		return item, err
+	}
+
+	err = is.Brands.CheckAccess(userID, role, current.BrandID, item.BrandID)
+	if err != nil {
+		return item, err
+	}
+
+	err = is.checkBrand(item.BrandID)
+	if err != nil {
+		return item, err
+	}
+
+	if item.ImageID != current.ImageID {
+		err = is.Images.Check(item.ImageID)
+		if err != nil {
+			return item, err
+		}
+	}
+
+	_, err = is.ItemRepo.Update(item)
 	if err != nil {
 		return item, errors.Wrap(err, "can`t update repo")
 	}
 
-	return item, nil
+	return is.Get(item.ID)
 }
 
-func (is ItemService) Delete(id int) error {
-	err := is.ItemRepo.Delete(id)
+func (is ItemService) Delete(id int, userID int, role string) error {
+	err := is.checkItemAccess(id, userID, role)
+	if err != nil {
+		return err
+	}
+
+	err = is.ItemRepo.Delete(id)
 	if err != nil {
 		return errors.Wrap(err, "can`t delete from repo")
 	}
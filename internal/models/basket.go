@@ -4,10 +4,34 @@ type Basket struct {
 	ID    int         `valid:"-" json:"id" db:"id"`
 	Items []OrderItem `valid:"-" json:"items" db:"items"`
 	Price int         `valid:"-" json:"price" db:"price"`
+
+	Promo    string `valid:"-" json:"promo" db:"promo"`
+	Discount int    `valid:"-" json:"discount" db:"discount"`
+	Total    int    `valid:"-" json:"total" db:"total"`
+
+	Warnings []BasketWarning `valid:"-" json:"warnings" db:"-"`
+}
+
+const (
+	BasketWarningPriceChanged = "price_changed"
+	BasketWarningUnavailable  = "unavailable"
+)
+
+type BasketWarning struct {
+	ItemID   int    `valid:"-" json:"item_id"`
+	Kind     string `valid:"-" json:"kind" example:"price_changed"`
+	OldPrice int    `valid:"-" json:"old_price,omitempty"`
+	NewPrice int    `valid:"-" json:"new_price,omitempty"`
+}
+
+type BasketLine struct {
+	ItemID int `valid:"-" json:"item_id"`
+	Amount int `valid:"range(0|1000)" json:"amount"`
 }
 
 func NewBasket() *Basket {
 	return &Basket{
-		Items: []OrderItem{},
+		Items:    []OrderItem{},
+		Warnings: []BasketWarning{},
 	}
 }
@@ -6,4 +6,51 @@ type Brand struct {
 	Year  int    `valid:"-" json:"year" db:"founding_year"`
 	Logo  int    `valid:"-" json:"logo" db:"logo_id"`
 	Owner string `valid:"-" json:"owner" db:"brand_owner"`
+
+	Archived bool `valid:"-" json:"-" db:"archived"`
+
+	HasLogo bool   `valid:"-" json:"-" db:"has_logo"`
+	LogoURL string `valid:"-" json:"logo_url" db:"-"`
+}
+
+// SetLogoURL fills in where the logo of the brand is served, leaving the URL
+// empty when it was never uploaded.
+func (brand *Brand) SetLogoURL() {
+	if brand.HasLogo {
+		brand.LogoURL = ImageURL(brand.Logo)
+	}
+}
+
+const (
+	BrandsOrderName = "name"
+	BrandsOrderYear = "year"
+)
+
+type BrandSummary struct {
+	Brand
+	ItemCount int `valid:"-" json:"item_count" db:"item_count"`
+	MinPrice  int `valid:"-" json:"min_price" db:"min_price"`
+	MaxPrice  int `valid:"-" json:"max_price" db:"max_price"`
+}
+
+type BrandsParams struct {
+	Q         string `valid:"maxstringlength(100)" json:"q" schema:"q" example:"nike"`
+	OrderBy   string `valid:"in(name|year|any)" json:"OrderBy" schema:"OrderBy" example:"name|year|any"`
+	Order     string `valid:"in(asc|desc)" json:"Order" schema:"Order" example:"asc|desc"`
+	Page_size int    `valid:"range(0|100)" json:"Page_size" schema:"Page_size" example:"20"`
+	Page_num  int    `valid:"range(0|1000000)" json:"Page_num" schema:"Page_num" example:"1"`
+	Cursor    string `valid:"maxstringlength(500)" json:"cursor" schema:"cursor"`
+	WithTotal bool   `valid:"-" json:"with_total" schema:"with_total" example:"true"`
+}
+
+// BrandDelete says what to do with the items of a brand being deleted: move
+// them to another brand, or hide them together with the brand. Without
+// either a brand that still has items is not deleted.
+type BrandDelete struct {
+	ReassignTo int  `valid:"-" json:"reassign_to" schema:"reassign_to" example:"2"`
+	Archive    bool `valid:"-" json:"archive" schema:"archive" example:"true"`
+}
+
+type BrandInUse struct {
+	BlockingItems int `valid:"-" json:"blocking_items" example:"12"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import "github.com/pkg/errors"
+
+var (
+	ErrItemNotAvailable = errors.New("item is not available")
+	ErrOutOfStock       = errors.New("not enough items in stock")
+	ErrBadTransition    = errors.New("order status transition is not allowed")
+	ErrForbidden        = errors.New("access denied")
+	ErrBadReturn        = errors.New("return request is not valid")
+	ErrBadPromo         = errors.New("promo code is not valid")
+	ErrPriceChanged     = errors.New("basket prices changed since last view")
+	ErrReviewExists     = errors.New("item is already reviewed by user")
+	ErrBrandInUse       = errors.New("brand still has items")
+	ErrBadBrandDelete   = errors.New("brand delete mode is not valid")
+	ErrBadManager       = errors.New("user can`t manage brands")
+	ErrBadImage         = errors.New("image is not a jpeg, png or gif picture")
+	ErrImageTooLarge    = errors.New("image is too large")
+	ErrNoImage          = errors.New("no such image")
+	ErrNoBrand          = errors.New("no such brand")
+)
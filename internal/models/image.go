@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// ImageMaxPixels bounds the memory one upload takes: a picture is decoded
+// whole and copied to RGBA for resizing, about 8 bytes per pixel, so 16M
+// pixels take some 130MB.
+const (
+	ImageMaxSize   = 5 << 20
+	ImageMaxPixels = 16_000_000
+
+	ImagesPath = "/images/"
+
+	ImageVariantThumb = "thumb"
+	ImageVariantCard  = "card"
+	ImageVariantFull  = "full"
+)
+
+type ImageVariantSize struct {
+	Name    string
+	MaxSide int
+}
+
+// ImageVariantSizes are generated on upload, largest first, so that each one
+// can be scaled from the previous instead of from the original.
+var ImageVariantSizes = []ImageVariantSize{
+	{ImageVariantFull, 1600},
+	{ImageVariantCard, 480},
+	{ImageVariantThumb, 160},
+}
+
+// ImageFormats maps the formats image.DecodeConfig reports to the content
+// types images are served with.
+var ImageFormats = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+type Image struct {
+	ID          int       `valid:"-" json:"id" db:"id"`
+	ContentType string    `valid:"-" json:"content_type" db:"content_type"`
+	Size        int       `valid:"-" json:"size" db:"size"`
+	Width       int       `valid:"-" json:"width" db:"width"`
+	Height      int       `valid:"-" json:"height" db:"height"`
+	BlobKey     string    `valid:"-" json:"-" db:"blob_key"`
+	CreatedAt   time.Time `valid:"-" json:"created_at" db:"created_at"`
+
+	URL      string         `valid:"-" json:"url" db:"-"`
+	Variants []ImageVariant `valid:"-" json:"variants" db:"-"`
+}
+
+type ImageVariant struct {
+	ImageID     int    `valid:"-" json:"-" db:"image_id"`
+	Variant     string `valid:"-" json:"variant" db:"variant" example:"thumb"`
+	ContentType string `valid:"-" json:"content_type" db:"content_type"`
+	Size        int    `valid:"-" json:"size" db:"size"`
+	Width       int    `valid:"-" json:"width" db:"width"`
+	Height      int    `valid:"-" json:"height" db:"height"`
+	BlobKey     string `valid:"-" json:"-" db:"blob_key"`
+
+	URL string `valid:"-" json:"url" db:"-"`
+}
+
+type ImageParams struct {
+	Variant string `valid:"in(thumb|card|full)" json:"variant" schema:"variant" example:"thumb"`
+}
+
+// ImageURL is where the image with the id is served, empty for no image.
+func ImageURL(id int) string {
+	if id <= 0 {
+		return ""
+	}
+
+	return ImagesPath + strconv.Itoa(id)
+}
+
+func ImageVariantURL(id int, variant string) string {
+	if id <= 0 {
+		return ""
+	}
+
+	return ImageURL(id) + "?variant=" + variant
+}
+
+// ImageVariantURLs maps the names of the variants the image has to their
+// URLs, nil for no image or an image uploaded before variants were made.
+func ImageVariantURLs(id int, variants []string) map[string]string {
+	if id <= 0 || len(variants) == 0 {
+		return nil
+	}
+
+	urls := make(map[string]string, len(variants))
+	for _, variant := range variants {
+		urls[variant] = ImageVariantURL(id, variant)
+	}
+
+	return urls
+}
@@ -1,7 +1,11 @@
 package models
 
+import "github.com/lib/pq"
+
 type Item struct {
 	ID          int    `valid:"-" json:"id" db:"id"`
+	Title       string `valid:"maxstringlength(200)" json:"title" db:"title"`
+	Description string `valid:"maxstringlength(5000)" json:"description" db:"description"`
 	Category    string `valid:"in(ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа)" json:"category" db:"category"`
 	Size        string `valid:"in(XS|S|M|L|XL|XXL)" json:"size" db:"size"`
 	Price       int    `valid:"-" json:"price" db:"price"`
@@ -9,23 +13,62 @@ type Item struct {
 	ImageID     int    `valid:"-" json:"image_id" db:"image_id"`
 	BrandID     int    `valid:"-" json:"brand_id" db:"brand_id"`
 	IsAvailable bool   `valid:"-" json:"is_available" db:"is_available"`
+	Stock       int    `valid:"-" json:"stock" db:"stock"`
+	Reserved    int    `valid:"-" json:"reserved" db:"reserved"`
+
+	Rating      float64 `valid:"-" json:"rating" db:"rating"`
+	ReviewCount int     `valid:"-" json:"review_count" db:"review_count"`
+
+	HasImage          bool              `valid:"-" json:"-" db:"has_image"`
+	ImageVariantNames pq.StringArray    `valid:"-" json:"-" db:"image_variant_names"`
+	ImageURL          string            `valid:"-" json:"image_url" db:"-"`
+	ImageVariants     map[string]string `valid:"-" json:"image_variants,omitempty" db:"-"`
+}
+
+// SetImageURLs fills in where the picture of the item is served, leaving the
+// URLs empty when it was never uploaded.
+func (item *Item) SetImageURLs() {
+	if !item.HasImage {
+		return
+	}
+
+	item.ImageURL = ImageURL(item.ImageID)
+	item.ImageVariants = ImageVariantURLs(item.ImageID, item.ImageVariantNames)
 }
 
+var ItemCategories = []string{"ботинки", "кроссовки", "майка", "футболка", "куртка", "штаны", "шорты", "ремень", "шляпа"}
+
+var ItemSizes = []string{"XS", "S", "M", "L", "XL", "XXL"}
+
 const (
-	ItemsParamsAny = "any"
-	ItemsOrderDesc = "desc"
-	ItemsOrderAsc  = "asc"
+	ItemsParamsAny   = "any"
+	ItemsOrderDesc   = "desc"
+	ItemsOrderAsc    = "asc"
+	ItemsOrderRating = "rating"
 )
 
 type ItemsPatchPrice struct {
-	NewPrice       int    `valid:"-" json:"price" db:"price"`
+	NewPrice int `valid:"-" json:"price" db:"price"`
+}
+
+type ItemsPatchStock struct {
+	NewStock int `valid:"range(0|1000000)" json:"stock" db:"stock"`
 }
 
 type ItemsParams struct {
-	WhereCategory string `valid:"in(ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа|any)" json:"WhereCategory" schema:"WhereCategory" example:"ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа|any"`
-	WhereSex      string `valid:"in(male|female|any)" json:"WhereSex" schema:"WhereSex" example:"male|female|any"`
-	WhereBrand    int    `valid:"-" json:"WhereBrand" schema:"WhereBrand" example:1`
-	OrderBy    string `valid:"in(asc|desc|any)" json:"OrderBy" schema:"OrderBy" example:"asc|desc|any"`
-	Page_size int	`valid:"-" json:"Page_size" schema:"Page_size" example:50`
-	Page_num int	`valid:"-" json:"Page_num"  schema:"Page_num" example:1`
+	WhereCategory   string   `valid:"in(ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа|any)" json:"WhereCategory" schema:"WhereCategory" example:"ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа|any"`
+	WhereSex        string   `valid:"in(male|female|any)" json:"WhereSex" schema:"WhereSex" example:"male|female|any"`
+	WhereBrand      int      `valid:"-" json:"WhereBrand" schema:"WhereBrand" example:"1"`
+	Q               string   `valid:"maxstringlength(200)" json:"q" schema:"q" example:"кожаные ботинки"`
+	WhereCategories []string `valid:"-" json:"WhereCategories" schema:"WhereCategories" example:"ботинки"`
+	WhereBrands     []int    `valid:"-" json:"WhereBrands" schema:"WhereBrands" example:"1"`
+	WhereSizes      []string `valid:"-" json:"WhereSizes" schema:"WhereSizes" example:"M"`
+	PriceMin        int      `valid:"range(0|10000000)" json:"PriceMin" schema:"PriceMin" example:"1000"`
+	PriceMax        int      `valid:"range(0|10000000)" json:"PriceMax" schema:"PriceMax" example:"5000"`
+	InStock         bool     `valid:"-" json:"InStock" schema:"InStock" example:"true"`
+	OrderBy         string   `valid:"in(asc|desc|rating|any)" json:"OrderBy" schema:"OrderBy" example:"asc|desc|rating|any"`
+	Page_size       int      `valid:"-" json:"Page_size" schema:"Page_size" example:"50"`
+	Page_num        int      `valid:"-" json:"Page_num"  schema:"Page_num" example:"1"`
+	Cursor          string   `valid:"maxstringlength(500)" json:"cursor" schema:"cursor"`
+	WithTotal       bool     `valid:"-" json:"with_total" schema:"with_total" example:"true"`
 }
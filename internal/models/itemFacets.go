@@ -0,0 +1,25 @@
+package models
+
+// ItemsPriceBuckets are the lower bounds of the price ranges counted by the
+// price facet; the last range is open-ended.
+var ItemsPriceBuckets = []int{0, 1000, 3000, 5000, 10000}
+
+type FacetCount struct {
+	Value string `valid:"-" json:"value" db:"value"`
+	Label string `valid:"-" json:"label,omitempty" db:"label"`
+	Count int    `valid:"-" json:"count" db:"count"`
+}
+
+type PriceFacetCount struct {
+	From  int `valid:"-" json:"from"`
+	To    int `valid:"-" json:"to,omitempty"`
+	Count int `valid:"-" json:"count"`
+}
+
+type ItemsFacets struct {
+	Categories []FacetCount      `valid:"-" json:"categories"`
+	Sizes      []FacetCount      `valid:"-" json:"sizes"`
+	Sexes      []FacetCount      `valid:"-" json:"sexes"`
+	Brands     []FacetCount      `valid:"-" json:"brands"`
+	Prices     []PriceFacetCount `valid:"-" json:"prices"`
+}
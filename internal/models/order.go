@@ -3,20 +3,68 @@ package models
 import "time"
 
 type Order struct {
-	ID     int         `valid:"-" json:"id" db:"id"`
-	Date   time.Time   `valid:"-" json:"date" db:"commit_date"`
-	UserID int         `valid:"-" json:"user" db:"user_id"`
-	Items  []OrderItem `valid:"-" json:"items" db:"items"`
-	Price  int         `valid:"-" json:"price" db:"price"`
-	Status string      `valid:"-" json:"status" db:"current_status"`
+	ID       int         `valid:"-" json:"id" db:"id"`
+	Date     time.Time   `valid:"-" json:"date" db:"commit_date"`
+	UserID   int         `valid:"-" json:"user" db:"user_id"`
+	Items    []OrderItem `valid:"-" json:"items" db:"items"`
+	Price    int         `valid:"-" json:"price" db:"price"`
+	Status   string      `valid:"-" json:"status" db:"current_status"`
+	Refund   int         `valid:"-" json:"refund" db:"refund"`
+	PromoID  *int        `valid:"-" json:"promo_id" db:"promo_id"`
+	Discount int         `valid:"-" json:"discount" db:"discount"`
+
+	History []OrderStatusChange `valid:"-" json:"history" db:"-"`
+}
+
+type OrderStatusChange struct {
+	ID        int       `valid:"-" json:"id" db:"id"`
+	OrderID   int       `valid:"-" json:"order_id" db:"order_id"`
+	Status    string    `valid:"-" json:"status" db:"status"`
+	ChangedBy int       `valid:"-" json:"changed_by" db:"changed_by"`
+	Date      time.Time `valid:"-" json:"date" db:"changed_at"`
+	Comment   string    `valid:"-" json:"comment" db:"comment"`
+}
+
+const (
+	OrderStatusBasket    = "корзина"
+	OrderStatusPlaced    = "оформлен"
+	OrderStatusPaid      = "оплачен"
+	OrderStatusShipped   = "отправлен"
+	OrderStatusDelivered = "доставлен"
+	OrderStatusCanceled  = "отменен"
+	OrderStatusReturned  = "возврат"
+)
+
+type OrderStatusUpdate struct {
+	Status  string `valid:"in(оформлен|оплачен|отправлен|доставлен|отменен|возврат)" json:"status" example:"оплачен"`
+	Comment string `valid:"maxstringlength(500)" json:"comment"`
 }
 
-type orderUser struct {
-	User_ID int	`valid:"-" json:"User_ID"  schema:"User_ID" example:1`
+type OrderCommit struct {
+	ConfirmPrices bool `valid:"-" json:"confirm_prices" schema:"confirm_prices" example:"true"`
+}
+
+type OrderCancel struct {
+	Reason string `valid:"required,maxstringlength(500)" json:"reason" example:"ordered by mistake"`
+}
+
+const (
+	OrdersDefaultPageSize = 20
+)
+
+type OrdersParams struct {
+	WhereStatus string `valid:"in(оформлен|оплачен|отправлен|доставлен|отменен|возврат|any)" json:"WhereStatus" schema:"WhereStatus" example:"оформлен|оплачен|отправлен|доставлен|отменен|возврат|any"`
+	DateFrom    string `valid:"matches(^[0-9]{4}-[0-9]{2}-[0-9]{2}$)" json:"DateFrom" schema:"DateFrom" example:"2023-01-01"`
+	DateTo      string `valid:"matches(^[0-9]{4}-[0-9]{2}-[0-9]{2}$)" json:"DateTo" schema:"DateTo" example:"2023-12-31"`
+	Page_size   int    `valid:"range(0|100)" json:"Page_size" schema:"Page_size" example:"20"`
+	Page_num    int    `valid:"range(0|1000000)" json:"Page_num" schema:"Page_num" example:"1"`
+	Cursor      string `valid:"maxstringlength(500)" json:"cursor" schema:"cursor"`
+	WithTotal   bool   `valid:"-" json:"with_total" schema:"with_total" example:"true"`
 }
 
 func NewOrder() *Order {
 	return &Order{
-		Items: []OrderItem{},
+		Items:   []OrderItem{},
+		History: []OrderStatusChange{},
 	}
 }
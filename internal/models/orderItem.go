@@ -2,5 +2,13 @@ package models
 
 type OrderItem struct {
 	Item
+	LineID int `valid:"-" json:"line_id" db:"line_id"`
 	Amount int `valid:"-" json:"amount" db:"amount"`
+
+	// HoldLeft is the number of seconds the basket line keeps its stock
+	// reserved; nil for lines without a hold.
+	HoldLeft *int `valid:"-" json:"hold_left,omitempty" db:"hold_left"`
+
+	// AddedPrice is the item price at the moment the line was put in the basket.
+	AddedPrice *int `valid:"-" json:"added_price,omitempty" db:"added_price"`
 }
@@ -0,0 +1,26 @@
+package models
+
+// PageInfo describes where a paginated listing continues. It is sent both in
+// the listing body and in the X-Next-Cursor, X-Total-Count and Link headers.
+type PageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// ItemsPage is one page of items.
+type ItemsPage struct {
+	Items []Item `json:"items"`
+	PageInfo
+}
+
+// OrdersPage is one page of orders.
+type OrdersPage struct {
+	Orders []Order `json:"orders"`
+	PageInfo
+}
+
+// BrandsPage is one page of brands.
+type BrandsPage struct {
+	Brands []BrandSummary `json:"brands"`
+	PageInfo
+}
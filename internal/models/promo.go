@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	PromoKindPercent = "percent"
+	PromoKindFixed   = "fixed"
+)
+
+type Promo struct {
+	ID           int        `valid:"-" json:"id" db:"id"`
+	Code         string     `valid:"required,stringlength(3|32)" json:"code" db:"code"`
+	Kind         string     `valid:"required,in(percent|fixed)" json:"kind" db:"kind"`
+	Value        int        `valid:"required" json:"value" db:"value"`
+	MinTotal     int        `valid:"-" json:"min_total" db:"min_total"`
+	BrandID      int        `valid:"-" json:"brand_id" db:"brand_id"`
+	Category     string     `valid:"in(ботинки|кроссовки|майка|футболка|куртка|штаны|шорты|ремень|шляпа)" json:"category" db:"category"`
+	ExpiresAt    *time.Time `valid:"-" json:"expires_at" db:"expires_at"`
+	PerUserLimit int        `valid:"-" json:"per_user_limit" db:"per_user_limit"`
+	IsActive     bool       `valid:"-" json:"is_active" db:"is_active"`
+}
+
+type PromoApply struct {
+	Code string `valid:"required" json:"code" example:"SALE10"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+const (
+	ReturnStatusOpen     = "открыт"
+	ReturnStatusApproved = "одобрен"
+	ReturnStatusRejected = "отклонен"
+)
+
+type ReturnRequest struct {
+	ID        int          `valid:"-" json:"id" db:"id"`
+	OrderID   int          `valid:"-" json:"order_id" db:"order_id"`
+	UserID    int          `valid:"-" json:"user_id" db:"user_id"`
+	Status    string       `valid:"-" json:"status" db:"status"`
+	Reason    string       `valid:"-" json:"reason" db:"reason"`
+	Refund    int          `valid:"-" json:"refund" db:"refund"`
+	Date      time.Time    `valid:"-" json:"date" db:"created_at"`
+	DecidedBy *int         `valid:"-" json:"decided_by" db:"decided_by"`
+	DecidedAt *time.Time   `valid:"-" json:"decided_at" db:"decided_at"`
+	Comment   string       `valid:"-" json:"comment" db:"comment"`
+	Items     []ReturnItem `valid:"-" json:"items" db:"-"`
+}
+
+type ReturnItem struct {
+	LineID int `valid:"-" json:"line_id" db:"order_item_id"`
+	ItemID int `valid:"-" json:"item_id" db:"item_id"`
+	Amount int `valid:"-" json:"amount" db:"amount"`
+	Price  int `valid:"-" json:"price" db:"price"`
+}
+
+type ReturnLine struct {
+	LineID int `valid:"-" json:"line_id"`
+	Amount int `valid:"range(1|1000)" json:"amount"`
+}
+
+type ReturnCreate struct {
+	Reason string       `valid:"required,maxstringlength(500)" json:"reason" example:"does not fit"`
+	Items  []ReturnLine `valid:"required" json:"items"`
+}
+
+type ReturnDecision struct {
+	Status  string `valid:"in(одобрен|отклонен),required" json:"status" example:"одобрен"`
+	Comment string `valid:"maxstringlength(500)" json:"comment"`
+}
+
+type ReturnsParams struct {
+	WhereStatus string `valid:"in(открыт|одобрен|отклонен|any)" json:"WhereStatus" schema:"WhereStatus" example:"открыт|одобрен|отклонен|any"`
+}
+
+func NewReturnRequest() *ReturnRequest {
+	return &ReturnRequest{
+		Items: []ReturnItem{},
+	}
+}
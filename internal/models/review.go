@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	ReviewStatusPublished = "опубликован"
+	ReviewStatusHidden    = "скрыт"
+)
+
+type Review struct {
+	ID               int        `valid:"-" json:"id" db:"id"`
+	ItemID           int        `valid:"-" json:"item_id" db:"item_id"`
+	UserID           int        `valid:"-" json:"user_id" db:"user_id"`
+	Rating           int        `valid:"-" json:"rating" db:"rating"`
+	Text             string     `valid:"-" json:"text" db:"review_text"`
+	Status           string     `valid:"-" json:"status" db:"status"`
+	Date             time.Time  `valid:"-" json:"date" db:"created_at"`
+	ModeratedBy      *int       `valid:"-" json:"moderated_by,omitempty" db:"moderated_by"`
+	ModeratedAt      *time.Time `valid:"-" json:"moderated_at,omitempty" db:"moderated_at"`
+	ModeratorComment string     `valid:"-" json:"moderator_comment,omitempty" db:"moderator_comment"`
+}
+
+type ReviewCreate struct {
+	Rating int    `valid:"range(1|5),required" json:"rating" example:"5"`
+	Text   string `valid:"maxstringlength(2000)" json:"text" example:"fits well"`
+}
+
+type ReviewModeration struct {
+	Status  string `valid:"in(опубликован|скрыт),required" json:"status" example:"скрыт"`
+	Comment string `valid:"maxstringlength(500)" json:"comment"`
+}
+
+type ReviewsParams struct {
+	WhereStatus string `valid:"in(опубликован|скрыт|any)" json:"WhereStatus" schema:"WhereStatus" example:"опубликован|скрыт|any"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// SalesReportStatuses are the order statuses counted as sales: paid and not
+// canceled or returned since.
+var SalesReportStatuses = []string{OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered}
+
+type SalesReportParams struct {
+	DateFrom    string `valid:"matches(^[0-9]{4}-[0-9]{2}-[0-9]{2}$)" json:"DateFrom" schema:"DateFrom" example:"2023-01-01"`
+	DateTo      string `valid:"matches(^[0-9]{4}-[0-9]{2}-[0-9]{2}$)" json:"DateTo" schema:"DateTo" example:"2023-12-31"`
+	WhereBrands []int  `valid:"-" json:"WhereBrands" schema:"WhereBrands" example:"1"`
+}
+
+type BrandSales struct {
+	BrandID   int    `valid:"-" json:"brand_id" db:"brand_id"`
+	BrandName string `valid:"-" json:"brand_name" db:"brand_name"`
+	Orders    int    `valid:"-" json:"orders" db:"orders"`
+	Units     int    `valid:"-" json:"units" db:"units"`
+	Revenue   int    `valid:"-" json:"revenue" db:"revenue"`
+}
@@ -0,0 +1,19 @@
+package models
+
+const SuggestLimit = 5
+
+type Suggestion struct {
+	ID    int     `valid:"-" json:"id,omitempty" db:"id"`
+	Text  string  `valid:"-" json:"text" db:"label"`
+	Score float64 `valid:"-" json:"-" db:"score"`
+}
+
+type Suggestions struct {
+	Brands     []Suggestion `valid:"-" json:"brands"`
+	Categories []Suggestion `valid:"-" json:"categories"`
+	Items      []Suggestion `valid:"-" json:"items"`
+}
+
+type SuggestParams struct {
+	Q string `valid:"required,maxstringlength(100)" json:"q" schema:"q" example:"krossovki"`
+}
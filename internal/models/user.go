@@ -6,5 +6,15 @@ type User struct {
 	Password string `valid:"minstringlength(5)" json:"password" db:"user_password"`
 	Name     string `valid:"minstringlength(2)" json:"name" db:"user_name"`
 	Sex      string `valid:"in(male|female)" json:"sex" db:"user_sex"`
-	Role     string `valid:"in(admin|guest|user)" json:"role" db:"user_role"`
+	Role     string `valid:"in(admin|guest|user|brand_manager)" json:"role" db:"user_role"`
 }
+
+const (
+	UserRoleAdmin = "admin"
+	UserRoleUser  = "user"
+	UserRoleGuest = "guest"
+
+	// UserRoleBrandManager may only edit the items and brands bound to it
+	// in BrandManager.
+	UserRoleBrandManager = "brand_manager"
+)
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type WishlistItem struct {
+	Item
+	BrandName string    `valid:"-" json:"brand_name" db:"brand_name"`
+	AddedAt   time.Time `valid:"-" json:"added_at" db:"added_at"`
+}
@@ -2,6 +2,7 @@ package delivery
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -9,21 +10,28 @@ import (
 
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
+	"github.com/pkg/errors"
 )
 
 type OrderService interface {
 	Get(int) (models.Order, error)
-	GetUsersAll(int) ([]models.Order, error)
-	Commit(int) error
-	Update(models.Order) (models.Order, error)
+	GetUsersAll(int, models.OrdersParams) ([]models.Order, models.PageInfo, error)
+	GetAll(models.OrdersParams) ([]models.Order, models.PageInfo, error)
+	Commit(int, models.OrderCommit) error
+	GetHistory(int) ([]models.OrderStatusChange, error)
+	UpdateStatus(int, models.OrderStatusUpdate, int) (models.Order, error)
+	Cancel(int, models.OrderCancel, int, string) (models.Order, error)
+	SalesReport(models.SalesReportParams, int, string) ([]models.BrandSales, error)
 }
 
 type ContextManager interface {
 	UserIDFromContext(ctx context.Context) (int, error)
+	UserRoleFromContext(ctx context.Context) (string, error)
 }
 
 type OrderHandler struct {
@@ -33,16 +41,36 @@ type OrderHandler struct {
 }
 
 // @Summary      Commit purchase
+// @Description  Refused with 409 when basket prices changed since it was last viewed, unless confirm_prices is set
 // @Tags         orders
 // @Accept       json
 // @Produce      json
+// @Param        confirm_prices    query	boolean  false  "Accept changed prices"
 // @Success      200
 // @Failure      401
 // @Failure      404
+// @Failure      409
 // @Failure      500
 // @Security ApiKeyAuth
 // @Router       /orders [post]
 func (bh *OrderHandler) Commit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		bh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	commit := new(models.OrderCommit)
+	err = schema.NewDecoder().Decode(commit, r.Form)
+	if err != nil {
+		bh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
 	userID, err := bh.ContextManager.UserIDFromContext(r.Context())
 	if err != nil {
 		bh.Logger.Errorw("fail to get id from context",
@@ -51,7 +79,19 @@ func (bh *OrderHandler) Commit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bh.OrderService.Commit(userID)
+	err = bh.OrderService.Commit(userID, *commit)
+	if errors.Is(err, models.ErrPriceChanged) {
+		bh.Logger.Infow("can`t commit order (prices changed)",
+			"err:", err.Error())
+		http.Error(w, "can`t commit order (prices changed, review basket and confirm)", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrOutOfStock) {
+		bh.Logger.Infow("can`t commit order (not enough items in stock)",
+			"err:", err.Error())
+		http.Error(w, "can`t commit order (not enough items in stock)", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		bh.Logger.Infow("can`t commit order",
 			"err:", err.Error())
@@ -125,17 +165,166 @@ func (oh *OrderHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// @Summary      Get all/user`s/my orders
+// @Summary      Get status history of order
 // @Tags         orders
 // @Accept       json
 // @Produce      json
-// @Param        USER_ID    query	integer  true  "ORDER_ID"
-// @Success      200  {array}  models.Order
+// @Param        ORDER_ID    path	integer  true  "ORDER_ID"
+// @Success      200  {array}  models.OrderStatusChange
+// @Failure      401
 // @Failure      403
 // @Failure      404
 // @Failure      500
 // @Security ApiKeyAuth
+// @Router       /orders/{ORDER_ID}/history [get]
+func (oh *OrderHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderIdString, ok := vars["ORDER_ID"]
+	if !ok {
+		oh.Logger.Errorw("no ORDER_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	orderId, err := strconv.Atoi(orderIdString)
+	if err != nil {
+		oh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := oh.OrderService.GetHistory(orderId)
+	if errors.Is(err, sql.ErrNoRows) {
+		oh.Logger.Infow("can`t get order history",
+			"err:", err.Error())
+		http.Error(w, "no such order", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		oh.Logger.Infow("can`t get order history",
+			"err:", err.Error())
+		http.Error(w, "can`t get order history", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(history)
+
+	if err != nil {
+		oh.Logger.Errorw("can`t marshal order history",
+			"err:", err.Error())
+		http.Error(w, "can`t get order history", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		oh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get all orders
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        WhereStatus    query	string  false  "Status оформлен|оплачен|отправлен|доставлен|отменен|возврат|any"
+// @Param        DateFrom    query	string  false  "Committed on or after, YYYY-MM-DD"
+// @Param        DateTo    query	string  false  "Committed on or before, YYYY-MM-DD"
+// @Param        Page_size    query	integer  false  "Size of page"
+// @Param        Page_num    query	integer  false  "Number of page, starting from 1"
+// @Param        cursor    query	string  false  "Next page cursor from next_cursor or X-Next-Cursor"
+// @Param        with_total    query	boolean  false  "Count all matching orders into total and X-Total-Count"
+// @Success      200  {object}  models.OrdersPage
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, absent on the last one"
+// @Header       200  {integer}  X-Total-Count  "Number of matching orders, with with_total only"
+// @Header       200  {string}  Link  "Next page, rel=next"
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
 // @Router       /orders [get]
+func (oh *OrderHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	ordersParams := new(models.OrdersParams)
+	err = schema.NewDecoder().Decode(ordersParams, r.Form)
+	if err != nil {
+		oh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(ordersParams)
+	if err != nil {
+		oh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	orders, page, err := oh.OrderService.GetAll(*ordersParams)
+	if err != nil {
+		oh.Logger.Infow("can`t get orders",
+			"err:", err.Error())
+		http.Error(w, "can`t get orders", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(models.OrdersPage{Orders: orders, PageInfo: page})
+
+	if err != nil {
+		oh.Logger.Errorw("can`t marshal orders",
+			"err:", err.Error())
+		http.Error(w, "can`t get orders", http.StatusInternalServerError)
+		return
+	}
+
+	pagination.WriteHeaders(w, r, page.NextCursor, page.Total)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		oh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get my orders
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        WhereStatus    query	string  false  "Status оформлен|оплачен|отправлен|доставлен|отменен|возврат|any"
+// @Param        DateFrom    query	string  false  "Committed on or after, YYYY-MM-DD"
+// @Param        DateTo    query	string  false  "Committed on or before, YYYY-MM-DD"
+// @Param        Page_size    query	integer  false  "Size of page"
+// @Param        Page_num    query	integer  false  "Number of page, starting from 1"
+// @Param        cursor    query	string  false  "Next page cursor from next_cursor or X-Next-Cursor"
+// @Param        with_total    query	boolean  false  "Count all matching orders into total and X-Total-Count"
+// @Success      200  {object}  models.OrdersPage
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, absent on the last one"
+// @Header       200  {integer}  X-Total-Count  "Number of matching orders, with with_total only"
+// @Header       200  {string}  Link  "Next page, rel=next"
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /orders/my [get]
 func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -145,8 +334,8 @@ func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderUser := new(models.orderUser)
-	err = schema.NewDecoder().Decode(orderUser, r.Form)
+	ordersParams := new(models.OrdersParams)
+	err = schema.NewDecoder().Decode(ordersParams, r.Form)
 	if err != nil {
 		oh.Logger.Infow("can`t decode form to struct",
 			"err:", err.Error())
@@ -154,7 +343,7 @@ func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = govalidator.ValidateStruct(orderUser)
+	_, err = govalidator.ValidateStruct(ordersParams)
 	if err != nil {
 		oh.Logger.Infow("can`t validate form",
 			"err:", err.Error())
@@ -162,16 +351,15 @@ func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//userID, err := oh.ContextManager.UserIDFromContext(r.Context())
-	// if err != nil {
-	// 	oh.Logger.Errorw("fail to get id from context",
-	// 		"err:", err.Error())
-	// 	http.Error(w, "unknown error", http.StatusInternalServerError)
-	// 	return
-	// }
-	userID := orderUser.User_ID
+	userID, err := oh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		oh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
 
-	orders, err := oh.OrderService.GetUsersAll(userID)
+	orders, page, err := oh.OrderService.GetUsersAll(userID, *ordersParams)
 	if err != nil {
 		oh.Logger.Infow("can`t get order",
 			"err:", err.Error())
@@ -179,7 +367,7 @@ func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := json.Marshal(orders)
+	resp, err := json.Marshal(models.OrdersPage{Orders: orders, PageInfo: page})
 
 	if err != nil {
 		oh.Logger.Errorw("can`t marshal orders",
@@ -188,6 +376,7 @@ func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pagination.WriteHeaders(w, r, page.NextCursor, page.Total)
 	w.WriteHeader(http.StatusOK)
 
 	_, err = w.Write(resp)
@@ -199,20 +388,127 @@ func (oh *OrderHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// @Summary      Update order
+// @Summary      Move order to the next status
 // @Tags         orders
 // @Accept       json
 // @Produce      json
 // @Param        ORDER_ID    path	integer  true  "ID of order"
-// @Param 		 order_model body models.Order true "updated order"
-// @Success      200
+// @Param 		 status body models.OrderStatusUpdate true "new status"
+// @Success      200  {object}  models.Order
+// @Failure      400
+// @Failure      401
+// @Failure      404
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /orders/{ORDER_ID}/status [post]
+func (oh *OrderHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderIdString, ok := vars["ORDER_ID"]
+	if !ok {
+		oh.Logger.Errorw("no ORDER_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	orderId, err := strconv.Atoi(orderIdString)
+	if err != nil {
+		oh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	statusUpdate := &models.OrderStatusUpdate{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		oh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, statusUpdate)
+	if err != nil {
+		oh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(statusUpdate)
+	if err != nil {
+		oh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := oh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		oh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	order, err := oh.OrderService.UpdateStatus(orderId, *statusUpdate, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		oh.Logger.Infow("can`t update order status",
+			"err:", err.Error())
+		http.Error(w, "no such order", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrBadTransition) {
+		oh.Logger.Infow("can`t update order status",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		oh.Logger.Infow("can`t update order status",
+			"err:", err.Error())
+		http.Error(w, "can`t update order status", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(order)
+
+	if err != nil {
+		oh.Logger.Errorw("can`t marshal order",
+			"err:", err.Error())
+		http.Error(w, "can`t make order", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		oh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Cancel order
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        ORDER_ID    path	integer  true  "ID of order"
+// @Param 		 cancel body models.OrderCancel true "cancellation reason"
+// @Success      200  {object}  models.Order
 // @Failure      400
 // @Failure      401
+// @Failure      403
 // @Failure      404
+// @Failure      409
 // @Failure      500
 // @Security ApiKeyAuth
-// @Router       /orders/{ORDER_ID} [post]
-func (oh *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
+// @Router       /orders/{ORDER_ID}/cancel [post]
+func (oh *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderIdString, ok := vars["ORDER_ID"]
 	if !ok {
@@ -229,7 +525,7 @@ func (oh *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order := &models.Order{}
+	cancel := &models.OrderCancel{}
 	body, err := io.ReadAll(r.Body)
 	r.Body.Close()
 	if err != nil {
@@ -239,7 +535,7 @@ func (oh *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(body, order)
+	err = json.Unmarshal(body, cancel)
 	if err != nil {
 		oh.Logger.Infow("can`t unmarshal form",
 			"err:", err.Error())
@@ -247,7 +543,7 @@ func (oh *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = govalidator.ValidateStruct(order)
+	_, err = govalidator.ValidateStruct(cancel)
 	if err != nil {
 		oh.Logger.Infow("can`t validate form",
 			"err:", err.Error())
@@ -255,12 +551,45 @@ func (oh *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order.ID = orderId
-	*order, err = oh.OrderService.Update(*order)
+	userID, err := oh.ContextManager.UserIDFromContext(r.Context())
 	if err != nil {
-		oh.Logger.Infow("can`t update order",
+		oh.Logger.Errorw("fail to get id from context",
 			"err:", err.Error())
-		http.Error(w, "can`t update order", http.StatusBadRequest)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	userRole, err := oh.ContextManager.UserRoleFromContext(r.Context())
+	if err != nil {
+		oh.Logger.Errorw("fail to get role from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	order, err := oh.OrderService.Cancel(orderId, *cancel, userID, userRole)
+	if errors.Is(err, sql.ErrNoRows) {
+		oh.Logger.Infow("can`t cancel order",
+			"err:", err.Error())
+		http.Error(w, "no such order", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrForbidden) {
+		oh.Logger.Infow("can`t cancel order",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrBadTransition) {
+		oh.Logger.Infow("can`t cancel order",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		oh.Logger.Infow("can`t cancel order",
+			"err:", err.Error())
+		http.Error(w, "can`t cancel order", http.StatusBadRequest)
 		return
 	}
 
@@ -283,3 +612,94 @@ func (oh *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// @Summary      Get sales per brand
+// @Description  Counts paid, shipped and delivered orders. Brand managers see only the brands they manage
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        DateFrom    query	string  false  "Committed on or after, YYYY-MM-DD"
+// @Param        DateTo    query	string  false  "Committed on or before, YYYY-MM-DD"
+// @Param        WhereBrands    query	[]integer  false  "Brands, repeat the parameter"  collectionFormat(multi)
+// @Success      200  {array}  models.BrandSales
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /reports/sales [get]
+func (oh *OrderHandler) SalesReport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	reportParams := new(models.SalesReportParams)
+	err = schema.NewDecoder().Decode(reportParams, r.Form)
+	if err != nil {
+		oh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(reportParams)
+	if err != nil {
+		oh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := oh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		oh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	userRole, err := oh.ContextManager.UserRoleFromContext(r.Context())
+	if err != nil {
+		oh.Logger.Errorw("fail to get role from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	sales, err := oh.OrderService.SalesReport(*reportParams, userID, userRole)
+	if errors.Is(err, models.ErrForbidden) {
+		oh.Logger.Infow("can`t get sales report",
+			"err:", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		oh.Logger.Infow("can`t get sales report",
+			"err:", err.Error())
+		http.Error(w, "can`t get sales report", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(sales)
+
+	if err != nil {
+		oh.Logger.Errorw("can`t marshal sales report",
+			"err:", err.Error())
+		http.Error(w, "can`t get sales report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		oh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,22 +1,47 @@
 package repo
 
 import (
+	"database/sql"
+
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/pagination"
+	"github.com/el1ljah/cp_db/pkg/querybuilder"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
+// orderItemsQuery prefers the values snapshotted by CommitOrder, so committed
+// orders keep the price, category, size, sex, picture and brand they were
+// bought with even after the item is changed or deleted.
+const orderItemsQuery = `SELECT 
+	o.id as line_id, 
+	o.item_id as id, 
+	coalesce(o.category, i.category, '') as category, 
+	coalesce(o.size, i.size, '') as size, 
+	coalesce(o.price, i.price, 0) as price, 
+	coalesce(o.sex, i.sex, '') as sex, 
+	coalesce(o.image_id, i.image_id, 0) as image_id, 
+	coalesce(o.brand_id, i.brand_id, 0) as brand_id, 
+	coalesce(i.is_available, false) as is_available, 
+	o.amount 
+  FROM 
+	OrderItems o 
+	LEFT JOIN Item i ON o.item_id = i.id 
+  where 
+	o.order_id = $1;`
+
 type PgOrderRepo struct {
 	Logger logger.Logger
 	DB     *sqlx.DB
 }
 
-func (pbr *PgOrderRepo) Commit(id int) error {
+func (pbr *PgOrderRepo) Commit(id int, confirmPrices bool) error {
 	var res int
 
 	err := pbr.DB.Get(&res,
-		"SELECT CommitOrder($1)", id)
+		"SELECT CommitOrder($1, $2)", id, confirmPrices)
 	if err != nil {
 		return errors.Wrap(err, "can`t commit order in db")
 	}
@@ -24,7 +49,11 @@ func (pbr *PgOrderRepo) Commit(id int) error {
 	if res == 1 {
 		return errors.Errorf("can`t commit order (its empty)")
 	} else if res == 2 {
-		return errors.Errorf("can`t commit order (some items are not available)")
+		return errors.Wrap(models.ErrItemNotAvailable, "can`t commit order")
+	} else if res == 3 {
+		return errors.Wrap(models.ErrOutOfStock, "can`t commit order")
+	} else if res == 4 {
+		return errors.Wrap(models.ErrPriceChanged, "can`t commit order")
 	}
 
 	return nil
@@ -43,177 +72,299 @@ func (por *PgOrderRepo) Get(id int) (models.Order, error) {
 		return order, errors.Wrap(err, "can`t get from db")
 	}
 
-	rows, err := por.DB.Queryx(`SELECT 
-	i.id, 
-	i.category, 
-	i.size, 
-	i.price, 
-	i.sex, 
-	i.image_id, 
-	i.brand_id, 
-	i.is_available, 
-	o.amount 
-  FROM 
-	OrderItems o 
-	JOIN Item i ON o.item_id = i.id 
-  where 
-	o.order_id = $1;`, id)
+	order.Items = []models.OrderItem{}
+
+	err = por.DB.Select(&order.Items, orderItemsQuery, id)
 	if err != nil {
 		return order, errors.Wrap(err, "can`t get from db")
 	}
 
-	items := []models.OrderItem{}
+	return order, nil
+}
+
+// orderSortKeys is the keyset the order listings are paginated by, newest
+// first. Their cursors are marked with orderSortBy and orderSortOrder.
+const (
+	orderSortBy    = "date"
+	orderSortOrder = models.ItemsOrderDesc
+)
+
+var orderSortKeys = []querybuilder.SortKey{
+	{Expr: "commit_date", Desc: true},
+	{Expr: "id", Desc: true},
+}
+
+// ordersSelect lists committed orders of one user, or of everyone when user
+// is 0.
+func ordersSelect(user int, params models.OrdersParams, columns ...string) *querybuilder.SelectBuilder {
+	sb := querybuilder.Select(columns...).
+		From("Ordering").
+		Where("current_status != ?", models.OrderStatusBasket)
 
-	for rows.Next() {
-		item := models.OrderItem{}
+	if user != 0 {
+		sb.Where("user_id = ?", user)
+	}
+	if params.WhereStatus != models.ItemsParamsAny && params.WhereStatus != "" {
+		sb.Where("current_status = ?", params.WhereStatus)
+	}
+	if params.DateFrom != "" {
+		sb.Where("commit_date >= ?::date", params.DateFrom)
+	}
+	if params.DateTo != "" {
+		sb.Where("commit_date <= ?::date", params.DateTo)
+	}
+
+	return sb
+}
 
-		err := rows.StructScan(&item)
+func (por *PgOrderRepo) genGetAllQuery(user int, params models.OrdersParams) (string, []interface{}, error) {
+	sb := ordersSelect(user, params, "*")
+	offset := 0
+
+	if params.Cursor != "" {
+		cursor, err := pagination.DecodeKeys(params.Cursor, orderSortBy, orderSortOrder, len(orderSortKeys))
 		if err != nil {
-			return order, errors.Wrap(err, "can`t scan struct from db query result")
+			return "", nil, err
 		}
 
-		items = append(items, item)
+		sb.After(orderSortKeys, cursor.Values)
+	} else if params.Page_num > 1 {
+		offset = (params.Page_num - 1) * params.Page_size
 	}
 
-	order.Items = items
+	query, args := sb.OrderByKeys(orderSortKeys...).
+		Limit(params.Page_size + 1).
+		Offset(offset).
+		Build()
 
-	return order, nil
+	return query, args, nil
 }
 
-func (por *PgOrderRepo) GetAll() ([]models.Order, error) {
+// GetAll returns one page of orders of the user (0 for all users) and the
+// cursor of the next page, empty on the last one.
+func (por *PgOrderRepo) GetAll(user int, params models.OrdersParams) ([]models.Order, string, error) {
 	orders := []models.Order{}
 
-	rows, err := por.DB.Queryx("select * " +
-		"from Ordering where current_status != 'корзина'")
+	query, args, err := por.genGetAllQuery(user, params)
 	if err != nil {
-		return orders, errors.Wrap(err, "can`t get from db")
+		return orders, "", err
 	}
 
-	for rows.Next() {
-		order := models.Order{}
-
-		err := rows.StructScan(&order)
-		if err != nil {
-			return orders, errors.Wrap(err, "can`t scan struct from db query result")
-		}
+	por.Logger.Debugw("PgOrderRepo.GetAll()", "query", query)
+	err = por.DB.Select(&orders, query, args...)
+	if err != nil {
+		return orders, "", errors.Wrap(err, "can`t get from db")
+	}
 
-		orders = append(orders, order)
+	next := ""
+	if len(orders) > params.Page_size {
+		orders = orders[:params.Page_size]
+		last := orders[len(orders)-1]
+		next = pagination.Encode(pagination.Cursor{
+			OrderBy: orderSortBy,
+			Order:   orderSortOrder,
+			Values:  []interface{}{last.Date.Format("2006-01-02"), last.ID},
+		})
 	}
 
 	for i := range orders {
-		rows, err := por.DB.Queryx(`SELECT 
-		i.id, 
-		i.category, 
-		i.size, 
-		i.price, 
-		i.sex, 
-		i.image_id, 
-		i.brand_id, 
-		i.is_available, 
-		o.amount 
-	  FROM 
-		OrderItems o 
-		JOIN Item i ON o.item_id = i.id 
-	  where 
-		o.order_id = $1;`, orders[i].ID)
+		orders[i].Items = []models.OrderItem{}
+
+		err := por.DB.Select(&orders[i].Items, orderItemsQuery, orders[i].ID)
 		if err != nil {
-			return orders, errors.Wrap(err, "can`t get from db")
+			return orders, "", errors.Wrap(err, "can`t get from db")
 		}
+	}
 
-		items := []models.OrderItem{}
+	return orders, next, nil
+}
 
-		for rows.Next() {
-			item := models.OrderItem{}
+func (por *PgOrderRepo) Count(user int, params models.OrdersParams) (int, error) {
+	var total int
 
-			err := rows.StructScan(&item)
-			if err != nil {
-				return orders, errors.Wrap(err, "can`t scan struct from db query result")
-			}
+	query, args := ordersSelect(user, params, "id").BuildCount()
+	err := por.DB.Get(&total, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t count in db")
+	}
 
-			items = append(items, item)
-		}
+	return total, nil
+}
 
-		orders[i].Items = items
+// SalesReport sums the lines of sold orders per brand, at the prices they
+// were bought with and before order discounts. A nil params.WhereBrands
+// means every brand.
+func (por *PgOrderRepo) SalesReport(params models.SalesReportParams) ([]models.BrandSales, error) {
+	sales := []models.BrandSales{}
+
+	sb := querybuilder.Select(
+		"o.brand_id",
+		"coalesce(b.brand_name, '') as brand_name",
+		"count(distinct o.order_id) as orders",
+		"sum(o.amount) as units",
+		"sum(o.amount * o.price) as revenue").
+		From("OrderItems o").
+		Join("join Ordering ord on ord.id = o.order_id").
+		Join("left join Brand b on b.id = o.brand_id").
+		WhereIn("ord.current_status", pq.Array(models.SalesReportStatuses))
+
+	if params.WhereBrands != nil {
+		sb.WhereIn("o.brand_id", pq.Array(params.WhereBrands))
+	}
+	if params.DateFrom != "" {
+		sb.Where("ord.commit_date >= ?::date", params.DateFrom)
 	}
+	if params.DateTo != "" {
+		sb.Where("ord.commit_date <= ?::date", params.DateTo)
+	}
+
+	query, args := sb.GroupBy("o.brand_id", "b.brand_name").
+		OrderBy("revenue desc").
+		OrderBy("o.brand_id").
+		Build()
 
-	return orders, nil
+	err := por.DB.Select(&sales, query, args...)
+	if err != nil {
+		return sales, errors.Wrap(err, "can`t get from db")
+	}
+
+	return sales, nil
 }
 
-func (por *PgOrderRepo) GetUsersAll(user int) ([]models.Order, error) {
-	orders := []models.Order{}
+func (por *PgOrderRepo) UpdateStatus(change models.OrderStatusChange, from string) error {
+	tx, err := por.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
 
-	rows, err := por.DB.Queryx("select * "+
-		"from Ordering where user_id = $1 and current_status != 'корзина'", user)
+	res, err := tx.Exec(
+		"update Ordering "+
+			"set current_status = $1 "+
+			"where id = $2 and current_status = $3",
+		change.Status,
+		change.OrderID,
+		from)
 	if err != nil {
-		return orders, errors.Wrap(err, "can`t get from db")
+		return errors.Wrap(err, "can`t update table in db")
 	}
 
-	for rows.Next() {
-		order := models.Order{}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
 
-		err := rows.StructScan(&order)
-		if err != nil {
-			return orders, errors.Wrap(err, "can`t scan struct from db query result")
-		}
+	if affected == 0 {
+		return errors.Wrapf(models.ErrBadTransition, "order %d is not in status %s anymore", change.OrderID, from)
+	}
 
-		orders = append(orders, order)
+	_, err = tx.Exec(
+		"insert into OrderStatusHistory (order_id, status, changed_by, comment) "+
+			"values ($1, $2, $3, $4)",
+		change.OrderID,
+		change.Status,
+		change.ChangedBy,
+		change.Comment)
+	if err != nil {
+		return errors.Wrap(err, "can`t insert to db")
 	}
 
-	for i := range orders {
-		rows, err := por.DB.Queryx(`SELECT 
-		i.id, 
-		i.category, 
-		i.size, 
-		i.price, 
-		i.sex, 
-		i.image_id, 
-		i.brand_id, 
-		i.is_available, 
-		o.amount 
-	  FROM 
-		OrderItems o 
-		JOIN Item i ON o.item_id = i.id 
-	  where 
-		o.order_id = $1;`, orders[i].ID)
-		if err != nil {
-			return orders, errors.Wrap(err, "can`t get from db")
-		}
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
 
-		items := []models.OrderItem{}
+	return nil
+}
 
-		for rows.Next() {
-			item := models.OrderItem{}
+func (por *PgOrderRepo) Cancel(change models.OrderStatusChange, from string) error {
+	tx, err := por.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
 
-			err := rows.StructScan(&item)
-			if err != nil {
-				return orders, errors.Wrap(err, "can`t scan struct from db query result")
-			}
+	res, err := tx.Exec(
+		"update Ordering "+
+			"set current_status = $1 "+
+			"where id = $2 and current_status = $3",
+		change.Status,
+		change.OrderID,
+		from)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
 
-			items = append(items, item)
-		}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected == 0 {
+		return errors.Wrapf(models.ErrBadTransition, "order %d is not in status %s anymore", change.OrderID, from)
+	}
+
+	_, err = tx.Exec(
+		"update Item i "+
+			"set stock = i.stock + o.amount "+
+			"from OrderItems o "+
+			"where o.item_id = i.id and o.order_id = $1",
+		change.OrderID)
+	if err != nil {
+		return errors.Wrap(err, "can`t return items to stock in db")
+	}
+
+	_, err = tx.Exec(
+		"insert into OrderStatusHistory (order_id, status, changed_by, comment) "+
+			"values ($1, $2, $3, $4)",
+		change.OrderID,
+		change.Status,
+		change.ChangedBy,
+		change.Comment)
+	if err != nil {
+		return errors.Wrap(err, "can`t insert to db")
+	}
 
-		orders[i].Items = items
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
 	}
 
-	return orders, nil
+	return nil
 }
 
-func (por *PgOrderRepo) Update(order models.Order) (models.Order, error) {
-	_, err := por.DB.Exec(
-		"update Ordering "+
-			"set commit_date = $1, "+
-			"user_id = $2, "+
-			"price = $3, "+
-			"current_status = $4 "+
-			"where id = $5",
-		order.Date,
-		order.UserID,
-		order.Price,
-		order.Status,
-		order.ID)
+// GetHistory returns sql.ErrNoRows for an unknown order, which is told apart
+// from an order without status changes only when there are none.
+func (por *PgOrderRepo) GetHistory(id int) ([]models.OrderStatusChange, error) {
+	history := []models.OrderStatusChange{}
+
+	err := por.DB.Select(
+		&history,
+		"select * "+
+			"from OrderStatusHistory "+
+			"where order_id = $1 "+
+			"order by changed_at, id",
+		id)
 	if err != nil {
-		return order, errors.Wrap(err, "can`t update table in db")
+		return history, errors.Wrap(err, "can`t get from db")
 	}
 
-	return order, nil
+	if len(history) > 0 {
+		return history, nil
+	}
+
+	var exists bool
+
+	err = por.DB.Get(&exists,
+		"select exists(select 1 from Ordering where id = $1)",
+		id)
+	if err != nil {
+		return history, errors.Wrap(err, "can`t get from db")
+	}
+
+	if !exists {
+		return history, errors.Wrapf(sql.ErrNoRows, "no order %d", id)
+	}
+
+	return history, nil
 }
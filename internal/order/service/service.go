@@ -7,15 +7,34 @@ import (
 )
 
 type OrderRepo interface {
-	Commit(int) error
+	Commit(int, bool) error
 	Get(int) (models.Order, error)
-	GetUsersAll(int) ([]models.Order, error)
-	GetAll() ([]models.Order, error)
-	Update(models.Order) (models.Order, error)
+	GetAll(int, models.OrdersParams) ([]models.Order, string, error)
+	Count(int, models.OrdersParams) (int, error)
+	UpdateStatus(models.OrderStatusChange, string) error
+	Cancel(models.OrderStatusChange, string) error
+	GetHistory(int) ([]models.OrderStatusChange, error)
+	SalesReport(models.SalesReportParams) ([]models.BrandSales, error)
+}
+
+// BrandAccess tells which brands a brand manager may see the sales of.
+type BrandAccess interface {
+	CheckAccess(userID int, role string, brandIDs ...int) error
+	ManagedBrands(userID int) ([]int, error)
+}
+
+// orderTransitions are the status changes made by hand. Orders become
+// returned only when a return request is approved, which restocks the items
+// and credits the refund.
+var orderTransitions = map[string][]string{
+	models.OrderStatusPlaced:  {models.OrderStatusPaid, models.OrderStatusCanceled},
+	models.OrderStatusPaid:    {models.OrderStatusShipped, models.OrderStatusCanceled},
+	models.OrderStatusShipped: {models.OrderStatusDelivered},
 }
 
 type OrderService struct {
 	OrderRepo OrderRepo
+	Brands    BrandAccess
 	Logger    logger.Logger
 }
 
@@ -25,11 +44,25 @@ func (os OrderService) Get(id int) (models.Order, error) {
 		return models.Order{}, errors.Wrap(err, "can`t get from repo")
 	}
 
+	order.History, err = os.OrderRepo.GetHistory(id)
+	if err != nil {
+		return models.Order{}, errors.Wrap(err, "can`t get history from repo")
+	}
+
 	return order, nil
 }
 
-func (bs OrderService) Commit(id int) error  {
-	err := bs.OrderRepo.Commit(id)
+func (os OrderService) GetHistory(id int) ([]models.OrderStatusChange, error) {
+	history, err := os.OrderRepo.GetHistory(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get history from repo")
+	}
+
+	return history, nil
+}
+
+func (bs OrderService) Commit(id int, commit models.OrderCommit) error  {
+	err := bs.OrderRepo.Commit(id, commit.ConfirmPrices)
 	if err != nil {
 		return errors.Wrap(err, "can`t commit in repo")
 	}
@@ -37,29 +70,129 @@ func (bs OrderService) Commit(id int) error  {
 	return  nil
 }
 
-func (os OrderService) GetUsersAll(user int) ([]models.Order, error) {
-	orders, err := os.OrderRepo.GetUsersAll(user)
+func (os OrderService) GetUsersAll(user int, params models.OrdersParams) ([]models.Order, models.PageInfo, error) {
+	if params.Page_size == 0 {
+		params.Page_size = models.OrdersDefaultPageSize
+	}
+
+	orders, next, err := os.OrderRepo.GetAll(user, params)
 	if err != nil {
-		return nil, errors.Wrap(err, "can`t get from repo")
+		return nil, models.PageInfo{}, errors.Wrap(err, "can`t get from repo")
 	}
 
-	return orders, nil
+	page := models.PageInfo{NextCursor: next}
+
+	if params.WithTotal {
+		total, err := os.OrderRepo.Count(user, params)
+		if err != nil {
+			return nil, models.PageInfo{}, errors.Wrap(err, "can`t count in repo")
+		}
+
+		page.Total = &total
+	}
+
+	return orders, page, nil
 }
 
-func (os OrderService) GetAll() ([]models.Order, error) {
-	orders, err := os.OrderRepo.GetAll()
-	if err != nil {
-		return nil, errors.Wrap(err, "can`t get from repo")
+func (os OrderService) GetAll(params models.OrdersParams) ([]models.Order, models.PageInfo, error) {
+	return os.GetUsersAll(0, params)
+}
+
+func canTransition(from, to string) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
 	}
 
-	return orders, nil
+	return false
 }
 
-func (os OrderService) Update(order models.Order) (models.Order, error) {
-	order, err := os.OrderRepo.Update(order)
+func (os OrderService) UpdateStatus(id int, update models.OrderStatusUpdate, userID int) (models.Order, error) {
+	order, err := os.Get(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if !canTransition(order.Status, update.Status) {
+		return order, errors.Wrapf(models.ErrBadTransition, "can`t move order from %s to %s", order.Status, update.Status)
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:   id,
+		Status:    update.Status,
+		ChangedBy: userID,
+		Comment:   update.Comment,
+	}
+
+	if update.Status == models.OrderStatusCanceled {
+		err = os.OrderRepo.Cancel(change, order.Status)
+	} else {
+		err = os.OrderRepo.UpdateStatus(change, order.Status)
+	}
 	if err != nil {
 		return order, errors.Wrap(err, "can`t update repo")
 	}
 
-	return order, nil
+	return os.Get(id)
+}
+
+func (os OrderService) Cancel(id int, cancel models.OrderCancel, userID int, role string) (models.Order, error) {
+	order, err := os.Get(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if role != models.UserRoleAdmin {
+		if order.UserID != userID {
+			return models.Order{}, errors.Wrapf(models.ErrForbidden, "order %d belongs to another user", id)
+		}
+
+		if order.Status != models.OrderStatusPlaced {
+			return order, errors.Wrapf(models.ErrBadTransition, "can`t cancel order in status %s", order.Status)
+		}
+	}
+
+	if !canTransition(order.Status, models.OrderStatusCanceled) {
+		return order, errors.Wrapf(models.ErrBadTransition, "can`t cancel order in status %s", order.Status)
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:   id,
+		Status:    models.OrderStatusCanceled,
+		ChangedBy: userID,
+		Comment:   cancel.Reason,
+	}
+
+	err = os.OrderRepo.Cancel(change, order.Status)
+	if err != nil {
+		return order, errors.Wrap(err, "can`t cancel in repo")
+	}
+
+	return os.Get(id)
+}
+
+// SalesReport limits brand managers to their own brands, all of them when
+// no brands are asked for.
+func (os OrderService) SalesReport(params models.SalesReportParams, userID int, role string) ([]models.BrandSales, error) {
+	if role == models.UserRoleBrandManager && len(params.WhereBrands) == 0 {
+		brands, err := os.Brands.ManagedBrands(userID)
+		if err != nil {
+			return nil, err
+		}
+
+		params.WhereBrands = brands
+	}
+
+	err := os.Brands.CheckAccess(userID, role, params.WhereBrands...)
+	if err != nil {
+		return nil, err
+	}
+
+	sales, err := os.OrderRepo.SalesReport(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return sales, nil
 }
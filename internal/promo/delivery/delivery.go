@@ -0,0 +1,178 @@
+package delivery
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type PromoService interface {
+	Create(models.Promo) (models.Promo, error)
+	GetAll() ([]models.Promo, error)
+	Deactivate(int) error
+}
+
+type PromoHandler struct {
+	PromoService PromoService
+	Logger       logger.Logger
+}
+
+// @Summary      Add new promo code
+// @Tags         promos
+// @Accept       json
+// @Produce      json
+// @Param 		 promo_model body models.Promo true "new promo code"
+// @Success      201  {object}  models.Promo
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /promos [put]
+func (ph *PromoHandler) Create(w http.ResponseWriter, r *http.Request) {
+	promo := &models.Promo{}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		ph.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, promo)
+	if err != nil {
+		ph.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(promo)
+	if err != nil {
+		ph.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	*promo, err = ph.PromoService.Create(*promo)
+	if errors.Is(err, models.ErrBadPromo) {
+		ph.Logger.Infow("can`t create promo",
+			"err:", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		ph.Logger.Infow("can`t create promo",
+			"err:", err.Error())
+		http.Error(w, "can`t create promo", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(promo)
+
+	if err != nil {
+		ph.Logger.Errorw("can`t marshal promo",
+			"err:", err.Error())
+		http.Error(w, "can`t make promo", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		ph.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get all promo codes
+// @Tags         promos
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}  models.Promo
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /promos [get]
+func (ph *PromoHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	promos, err := ph.PromoService.GetAll()
+	if err != nil {
+		ph.Logger.Infow("can`t get promos",
+			"err:", err.Error())
+		http.Error(w, "can`t get promos", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(promos)
+
+	if err != nil {
+		ph.Logger.Errorw("can`t marshal promos",
+			"err:", err.Error())
+		http.Error(w, "can`t get promos", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		ph.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Deactivate promo code
+// @Tags         promos
+// @Accept       json
+// @Produce      json
+// @Param        PROMO_ID    path	integer  true  "ID of promo code"
+// @Success      200
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /promos/{PROMO_ID} [delete]
+func (ph *PromoHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	promoIdString, ok := vars["PROMO_ID"]
+	if !ok {
+		ph.Logger.Errorw("no PROMO_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	promoId, err := strconv.Atoi(promoIdString)
+	if err != nil {
+		ph.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	err = ph.PromoService.Deactivate(promoId)
+	if err != nil {
+		ph.Logger.Infow("can`t deactivate promo",
+			"err:", err.Error())
+		http.Error(w, "can`t deactivate promo", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
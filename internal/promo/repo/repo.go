@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const promoColumns = "id, code, kind, value, min_total, " +
+	"coalesce(brand_id, 0) as brand_id, " +
+	"coalesce(category, '') as category, " +
+	"expires_at, per_user_limit, is_active"
+
+type PgPromoRepo struct {
+	Logger logger.Logger
+	DB     *sqlx.DB
+}
+
+func (ppr *PgPromoRepo) Create(promo models.Promo) (int, error) {
+	var id int
+
+	err := ppr.DB.QueryRow(
+		"insert into PromoCode (code, kind, value, min_total, brand_id, category, expires_at, per_user_limit, is_active) "+
+			"values ($1, $2, $3, $4, nullif($5, 0), nullif($6, ''), $7, $8, $9) "+
+			"returning id",
+		promo.Code,
+		promo.Kind,
+		promo.Value,
+		promo.MinTotal,
+		promo.BrandID,
+		promo.Category,
+		promo.ExpiresAt,
+		promo.PerUserLimit,
+		promo.IsActive,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t insert to db")
+	}
+
+	return id, nil
+}
+
+func (ppr *PgPromoRepo) Get(id int) (models.Promo, error) {
+	promo := models.Promo{}
+
+	err := ppr.DB.Get(
+		&promo,
+		"select "+promoColumns+" "+
+			"from PromoCode "+
+			"where id = $1",
+		id)
+	if err != nil {
+		return promo, errors.Wrap(err, "can`t get from db")
+	}
+
+	return promo, nil
+}
+
+func (ppr *PgPromoRepo) GetAll() ([]models.Promo, error) {
+	promos := []models.Promo{}
+
+	err := ppr.DB.Select(
+		&promos,
+		"select "+promoColumns+" "+
+			"from PromoCode "+
+			"order by id")
+	if err != nil {
+		return promos, errors.Wrap(err, "can`t get from db")
+	}
+
+	return promos, nil
+}
+
+func (ppr *PgPromoRepo) Deactivate(id int) error {
+	_, err := ppr.DB.Exec(
+		"update PromoCode "+
+			"set is_active = false "+
+			"where id = $1",
+		id)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	return nil
+}
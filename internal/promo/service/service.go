@@ -0,0 +1,64 @@
+package service
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+type PromoRepo interface {
+	Create(models.Promo) (int, error)
+	Get(int) (models.Promo, error)
+	GetAll() ([]models.Promo, error)
+	Deactivate(int) error
+}
+
+type PromoService struct {
+	PromoRepo PromoRepo
+	Logger    logger.Logger
+}
+
+func (ps PromoService) Create(promo models.Promo) (models.Promo, error) {
+	if promo.Value <= 0 || (promo.Kind == models.PromoKindPercent && promo.Value > 100) {
+		return promo, errors.Wrapf(models.ErrBadPromo, "bad %s value %d", promo.Kind, promo.Value)
+	}
+
+	if promo.MinTotal < 0 || promo.PerUserLimit < 0 {
+		return promo, errors.Wrap(models.ErrBadPromo, "limits can`t be negative")
+	}
+
+	if promo.PerUserLimit == 0 {
+		promo.PerUserLimit = 1
+	}
+	promo.IsActive = true
+
+	id, err := ps.PromoRepo.Create(promo)
+	if err != nil {
+		return promo, errors.Wrap(err, "can`t add to repo")
+	}
+
+	promo, err = ps.PromoRepo.Get(id)
+	if err != nil {
+		return promo, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return promo, nil
+}
+
+func (ps PromoService) GetAll() ([]models.Promo, error) {
+	promos, err := ps.PromoRepo.GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return promos, nil
+}
+
+func (ps PromoService) Deactivate(id int) error {
+	err := ps.PromoRepo.Deactivate(id)
+	if err != nil {
+		return errors.Wrap(err, "can`t update repo")
+	}
+
+	return nil
+}
@@ -0,0 +1,414 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"github.com/pkg/errors"
+)
+
+type ReturnService interface {
+	Create(int, models.ReturnCreate, int) (models.ReturnRequest, error)
+	Get(int, int, string) (models.ReturnRequest, error)
+	GetAll(models.ReturnsParams) ([]models.ReturnRequest, error)
+	GetUsersAll(int) ([]models.ReturnRequest, error)
+	Decide(int, models.ReturnDecision, int) (models.ReturnRequest, error)
+}
+
+type ContextManager interface {
+	UserIDFromContext(ctx context.Context) (int, error)
+	UserRoleFromContext(ctx context.Context) (string, error)
+}
+
+type ReturnHandler struct {
+	ReturnService  ReturnService
+	ContextManager ContextManager
+	Logger         logger.Logger
+}
+
+func (rh *ReturnHandler) writeError(w http.ResponseWriter, err error, msg string) {
+	rh.Logger.Infow(msg,
+		"err:", err.Error())
+
+	switch {
+	case errors.Is(err, models.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, models.ErrBadTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, models.ErrBadReturn):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, msg, http.StatusBadRequest)
+	}
+}
+
+// @Summary      Open return request for delivered order
+// @Tags         returns
+// @Accept       json
+// @Produce      json
+// @Param        ORDER_ID    path	integer  true  "ID of order"
+// @Param 		 return_model body models.ReturnCreate true "returned lines"
+// @Success      201  {object}  models.ReturnRequest
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /orders/{ORDER_ID}/returns [post]
+func (rh *ReturnHandler) Create(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderIdString, ok := vars["ORDER_ID"]
+	if !ok {
+		rh.Logger.Errorw("no ORDER_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	orderId, err := strconv.Atoi(orderIdString)
+	if err != nil {
+		rh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	create := &models.ReturnCreate{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		rh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, create)
+	if err != nil {
+		rh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(create)
+	if err != nil {
+		rh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := rh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	ret, err := rh.ReturnService.Create(orderId, *create, userID)
+	if err != nil {
+		rh.writeError(w, err, "can`t create return")
+		return
+	}
+
+	resp, err := json.Marshal(ret)
+
+	if err != nil {
+		rh.Logger.Errorw("can`t marshal return",
+			"err:", err.Error())
+		http.Error(w, "can`t make return", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		rh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get an information about return request
+// @Tags         returns
+// @Accept       json
+// @Produce      json
+// @Param        RETURN_ID    path	integer  true  "RETURN_ID"
+// @Success      200  {object}  models.ReturnRequest
+// @Failure      401
+// @Failure      403
+// @Failure      404
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /returns/{RETURN_ID} [get]
+func (rh *ReturnHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	returnIdString, ok := vars["RETURN_ID"]
+	if !ok {
+		rh.Logger.Errorw("no RETURN_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	returnId, err := strconv.Atoi(returnIdString)
+	if err != nil {
+		rh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := rh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	userRole, err := rh.ContextManager.UserRoleFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get role from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	ret, err := rh.ReturnService.Get(returnId, userID, userRole)
+	if err != nil {
+		rh.writeError(w, err, "can`t get return")
+		return
+	}
+
+	resp, err := json.Marshal(ret)
+
+	if err != nil {
+		rh.Logger.Errorw("can`t marshal return",
+			"err:", err.Error())
+		http.Error(w, "can`t make return", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		rh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get all return requests
+// @Tags         returns
+// @Accept       json
+// @Produce      json
+// @Param        WhereStatus    query	string  false  "Status открыт|одобрен|отклонен|any"
+// @Success      200  {array}  models.ReturnRequest
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /returns [get]
+func (rh *ReturnHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		rh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	returnsParams := new(models.ReturnsParams)
+	err = schema.NewDecoder().Decode(returnsParams, r.Form)
+	if err != nil {
+		rh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(returnsParams)
+	if err != nil {
+		rh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	rets, err := rh.ReturnService.GetAll(*returnsParams)
+	if err != nil {
+		rh.writeError(w, err, "can`t get returns")
+		return
+	}
+
+	resp, err := json.Marshal(rets)
+
+	if err != nil {
+		rh.Logger.Errorw("can`t marshal returns",
+			"err:", err.Error())
+		http.Error(w, "can`t get returns", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		rh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Get my return requests
+// @Tags         returns
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}  models.ReturnRequest
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /returns/my [get]
+func (rh *ReturnHandler) GetAllMy(w http.ResponseWriter, r *http.Request) {
+	userID, err := rh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	rets, err := rh.ReturnService.GetUsersAll(userID)
+	if err != nil {
+		rh.writeError(w, err, "can`t get returns")
+		return
+	}
+
+	resp, err := json.Marshal(rets)
+
+	if err != nil {
+		rh.Logger.Errorw("can`t marshal returns",
+			"err:", err.Error())
+		http.Error(w, "can`t get returns", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		rh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// @Summary      Approve or reject return request
+// @Tags         returns
+// @Accept       json
+// @Produce      json
+// @Param        RETURN_ID    path	integer  true  "RETURN_ID"
+// @Param 		 decision body models.ReturnDecision true "decision"
+// @Success      200  {object}  models.ReturnRequest
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /returns/{RETURN_ID}/decision [post]
+func (rh *ReturnHandler) Decide(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	returnIdString, ok := vars["RETURN_ID"]
+	if !ok {
+		rh.Logger.Errorw("no RETURN_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	returnId, err := strconv.Atoi(returnIdString)
+	if err != nil {
+		rh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	decision := &models.ReturnDecision{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		rh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, decision)
+	if err != nil {
+		rh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(decision)
+	if err != nil {
+		rh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := rh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	ret, err := rh.ReturnService.Decide(returnId, *decision, userID)
+	if err != nil {
+		rh.writeError(w, err, "can`t decide return")
+		return
+	}
+
+	resp, err := json.Marshal(ret)
+
+	if err != nil {
+		rh.Logger.Errorw("can`t marshal return",
+			"err:", err.Error())
+		http.Error(w, "can`t make return", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		rh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
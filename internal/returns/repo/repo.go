@@ -0,0 +1,364 @@
+package repo
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/querybuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type PgReturnRepo struct {
+	Logger logger.Logger
+	DB     *sqlx.DB
+}
+
+func (prr *PgReturnRepo) GetOrder(id int) (models.Order, error) {
+	order := models.Order{}
+
+	err := prr.DB.Get(
+		&order,
+		"select * "+
+			"from Ordering "+
+			"where id = $1",
+		id)
+	if err != nil {
+		return order, errors.Wrap(err, "can`t get from db")
+	}
+
+	return order, nil
+}
+
+// returnableQuery lists the lines of an order with the units not yet taken
+// by open or approved returns.
+const returnableQuery = `SELECT 
+	o.id as order_item_id, 
+	o.item_id, 
+	o.amount - coalesce((
+		select 
+			sum(ri.amount) 
+		from 
+			ReturnItems ri 
+			JOIN ReturnRequest rr ON ri.return_id = rr.id 
+		where 
+			ri.order_item_id = o.id 
+			and rr.status != 'отклонен'
+	), 0) as amount, 
+	coalesce(o.price, i.price, 0) as price 
+  FROM 
+	OrderItems o 
+	LEFT JOIN Item i ON o.item_id = i.id 
+  where 
+	o.order_id = $1;`
+
+func (prr *PgReturnRepo) GetReturnable(orderID int) ([]models.ReturnItem, error) {
+	items := []models.ReturnItem{}
+
+	err := prr.DB.Select(&items, returnableQuery, orderID)
+	if err != nil {
+		return items, errors.Wrap(err, "can`t get from db")
+	}
+
+	return items, nil
+}
+
+// checkReturnable locks the lines of the order and checks again that the
+// return still fits into them, so concurrent requests can`t over-return.
+func checkReturnable(tx *sqlx.Tx, ret models.ReturnRequest) error {
+	_, err := tx.Exec(
+		"select id "+
+			"from OrderItems "+
+			"where order_id = $1 "+
+			"order by id "+
+			"for update",
+		ret.OrderID)
+	if err != nil {
+		return errors.Wrap(err, "can`t lock order lines in db")
+	}
+
+	returnable := []models.ReturnItem{}
+
+	err = tx.Select(&returnable, returnableQuery, ret.OrderID)
+	if err != nil {
+		return errors.Wrap(err, "can`t get from db")
+	}
+
+	left := map[int]int{}
+	for _, line := range returnable {
+		left[line.LineID] = line.Amount
+	}
+
+	for _, item := range ret.Items {
+		if item.Amount > left[item.LineID] {
+			return errors.Wrapf(models.ErrBadReturn, "only %d units of line %d can be returned", left[item.LineID], item.LineID)
+		}
+
+		left[item.LineID] -= item.Amount
+	}
+
+	return nil
+}
+
+func (prr *PgReturnRepo) Create(ret models.ReturnRequest) (int, error) {
+	tx, err := prr.DB.Beginx()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	err = checkReturnable(tx, ret)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+
+	err = tx.QueryRow(
+		"insert into ReturnRequest (order_id, user_id, status, reason, refund) "+
+			"values ($1, $2, $3, $4, $5) "+
+			"returning id",
+		ret.OrderID,
+		ret.UserID,
+		ret.Status,
+		ret.Reason,
+		ret.Refund,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t insert to db")
+	}
+
+	for _, item := range ret.Items {
+		_, err = tx.Exec(
+			"insert into ReturnItems (return_id, order_item_id, amount) "+
+				"values ($1, $2, $3)",
+			id,
+			item.LineID,
+			item.Amount)
+		if err != nil {
+			return 0, errors.Wrap(err, "can`t insert to db")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return id, nil
+}
+
+func (prr *PgReturnRepo) getItems(id int) ([]models.ReturnItem, error) {
+	items := []models.ReturnItem{}
+
+	err := prr.DB.Select(
+		&items,
+		`SELECT 
+	ri.order_item_id, 
+	o.item_id, 
+	ri.amount, 
+	coalesce(o.price, i.price, 0) as price 
+  FROM 
+	ReturnItems ri 
+	JOIN OrderItems o ON ri.order_item_id = o.id 
+	LEFT JOIN Item i ON o.item_id = i.id 
+  where 
+	ri.return_id = $1;`,
+		id)
+	if err != nil {
+		return items, errors.Wrap(err, "can`t get from db")
+	}
+
+	return items, nil
+}
+
+func (prr *PgReturnRepo) Get(id int) (models.ReturnRequest, error) {
+	ret := models.ReturnRequest{}
+
+	err := prr.DB.Get(
+		&ret,
+		"select * "+
+			"from ReturnRequest "+
+			"where id = $1",
+		id)
+	if err != nil {
+		return ret, errors.Wrap(err, "can`t get from db")
+	}
+
+	ret.Items, err = prr.getItems(id)
+	if err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
+
+func (prr *PgReturnRepo) selectWithItems(query string, args ...interface{}) ([]models.ReturnRequest, error) {
+	rets := []models.ReturnRequest{}
+
+	err := prr.DB.Select(&rets, query, args...)
+	if err != nil {
+		return rets, errors.Wrap(err, "can`t get from db")
+	}
+
+	for i := range rets {
+		rets[i].Items, err = prr.getItems(rets[i].ID)
+		if err != nil {
+			return rets, err
+		}
+	}
+
+	return rets, nil
+}
+
+func (prr *PgReturnRepo) GetAll(params models.ReturnsParams) ([]models.ReturnRequest, error) {
+	sb := querybuilder.Select("*").From("ReturnRequest")
+
+	if params.WhereStatus != models.ItemsParamsAny && params.WhereStatus != "" {
+		sb.Where("status = ?", params.WhereStatus)
+	}
+
+	query, args := sb.OrderBy("created_at desc").OrderBy("id desc").Build()
+
+	return prr.selectWithItems(query, args...)
+}
+
+func (prr *PgReturnRepo) GetUsersAll(user int) ([]models.ReturnRequest, error) {
+	return prr.selectWithItems(
+		"select * from ReturnRequest where user_id = $1 order by created_at desc, id desc",
+		user)
+}
+
+func (prr *PgReturnRepo) decide(tx *sqlx.Tx, ret models.ReturnRequest) error {
+	res, err := tx.Exec(
+		"update ReturnRequest "+
+			"set status = $1, "+
+			"decided_by = $2, "+
+			"decided_at = now(), "+
+			"comment = $3 "+
+			"where id = $4 and status = $5",
+		ret.Status,
+		ret.DecidedBy,
+		ret.Comment,
+		ret.ID,
+		models.ReturnStatusOpen)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected == 0 {
+		return errors.Wrapf(models.ErrBadTransition, "return %d is already decided", ret.ID)
+	}
+
+	return nil
+}
+
+func (prr *PgReturnRepo) Reject(ret models.ReturnRequest) error {
+	tx, err := prr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	err = prr.decide(tx, ret)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return nil
+}
+
+// Approve credits the refund stored at creation only up to what is left of
+// the order charge, checked under the order lock, and keeps the amount
+// actually credited on the return.
+func (prr *PgReturnRepo) Approve(ret models.ReturnRequest) error {
+	tx, err := prr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	order := models.Order{}
+
+	err = tx.Get(
+		&order,
+		"select * from Ordering where id = $1 for update",
+		ret.OrderID)
+	if err != nil {
+		return errors.Wrap(err, "can`t get from db")
+	}
+
+	err = prr.decide(tx, ret)
+	if err != nil {
+		return err
+	}
+
+	applied := max(0, min(ret.Refund, order.Price-order.Refund))
+
+	_, err = tx.Exec(
+		"update ReturnRequest set refund = $1 where id = $2",
+		applied,
+		ret.ID)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	// update ... from applies one joined row per item, so the units of every
+	// line of the same item are summed first.
+	_, err = tx.Exec(
+		"update Item i "+
+			"set stock = i.stock + r.amount "+
+			"from ("+
+			"select o.item_id, sum(ri.amount) as amount "+
+			"from ReturnItems ri "+
+			"join OrderItems o on ri.order_item_id = o.id "+
+			"where ri.return_id = $1 "+
+			"group by o.item_id"+
+			") r "+
+			"where r.item_id = i.id",
+		ret.ID)
+	if err != nil {
+		return errors.Wrap(err, "can`t return items to stock in db")
+	}
+
+	_, err = tx.Exec(
+		"update Ordering "+
+			"set refund = refund + $1, "+
+			"current_status = $2 "+
+			"where id = $3",
+		applied,
+		models.OrderStatusReturned,
+		ret.OrderID)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	if order.Status != models.OrderStatusReturned {
+		_, err = tx.Exec(
+			"insert into OrderStatusHistory (order_id, status, changed_by, comment) "+
+				"values ($1, $2, $3, $4)",
+			ret.OrderID,
+			models.OrderStatusReturned,
+			ret.DecidedBy,
+			ret.Comment)
+		if err != nil {
+			return errors.Wrap(err, "can`t insert to db")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+type ReturnRepo interface {
+	GetOrder(int) (models.Order, error)
+	GetReturnable(int) ([]models.ReturnItem, error)
+	Create(models.ReturnRequest) (int, error)
+	Get(int) (models.ReturnRequest, error)
+	GetAll(models.ReturnsParams) ([]models.ReturnRequest, error)
+	GetUsersAll(int) ([]models.ReturnRequest, error)
+	Approve(models.ReturnRequest) error
+	Reject(models.ReturnRequest) error
+}
+
+type ReturnService struct {
+	ReturnRepo ReturnRepo
+	Logger     logger.Logger
+}
+
+// refund prices the returned goods at what the customer paid: the order
+// discount is spread over the lines in proportion to their value, rounding
+// its share up, and the result never exceeds what is left of the charge.
+func refund(order models.Order, returned int) int {
+	subtotal := order.Price + order.Discount
+
+	amount := returned
+	if order.Discount > 0 && subtotal > 0 {
+		amount -= (returned*order.Discount + subtotal - 1) / subtotal
+	}
+
+	return max(0, min(amount, order.Price-order.Refund))
+}
+
+func (rs ReturnService) Create(orderID int, create models.ReturnCreate, userID int) (models.ReturnRequest, error) {
+	order, err := rs.ReturnRepo.GetOrder(orderID)
+	if err != nil {
+		return models.ReturnRequest{}, errors.Wrap(err, "can`t get order from repo")
+	}
+
+	if order.UserID != userID {
+		return models.ReturnRequest{}, errors.Wrapf(models.ErrForbidden, "order %d belongs to another user", orderID)
+	}
+
+	if order.Status != models.OrderStatusDelivered && order.Status != models.OrderStatusReturned {
+		return models.ReturnRequest{}, errors.Wrapf(models.ErrBadTransition, "can`t return order in status %s", order.Status)
+	}
+
+	returnable, err := rs.ReturnRepo.GetReturnable(orderID)
+	if err != nil {
+		return models.ReturnRequest{}, errors.Wrap(err, "can`t get order lines from repo")
+	}
+
+	lines := map[int]models.ReturnItem{}
+	for _, item := range returnable {
+		lines[item.LineID] = item
+	}
+
+	ret := models.NewReturnRequest()
+	ret.OrderID = orderID
+	ret.UserID = userID
+	ret.Status = models.ReturnStatusOpen
+	ret.Reason = create.Reason
+
+	// merged keeps one return item per order line when the same line is
+	// requested several times.
+	merged := map[int]int{}
+
+	for _, requested := range create.Items {
+		line, ok := lines[requested.LineID]
+		if !ok {
+			return models.ReturnRequest{}, errors.Wrapf(models.ErrBadReturn, "line %d is not in order %d", requested.LineID, orderID)
+		}
+
+		if requested.Amount <= 0 {
+			return models.ReturnRequest{}, errors.Wrapf(models.ErrBadReturn, "amount of line %d must be positive", requested.LineID)
+		}
+
+		if requested.Amount > line.Amount {
+			return models.ReturnRequest{}, errors.Wrapf(models.ErrBadReturn, "only %d units of line %d can be returned", line.Amount, requested.LineID)
+		}
+
+		line.Amount -= requested.Amount
+		lines[requested.LineID] = line
+
+		if i, ok := merged[requested.LineID]; ok {
+			ret.Items[i].Amount += requested.Amount
+		} else {
+			merged[requested.LineID] = len(ret.Items)
+			ret.Items = append(ret.Items, models.ReturnItem{
+				LineID: requested.LineID,
+				ItemID: line.ItemID,
+				Amount: requested.Amount,
+				Price:  line.Price,
+			})
+		}
+		ret.Refund += requested.Amount * line.Price
+	}
+
+	ret.Refund = refund(order, ret.Refund)
+
+	ret.ID, err = rs.ReturnRepo.Create(*ret)
+	if err != nil {
+		return models.ReturnRequest{}, errors.Wrap(err, "can`t add to repo")
+	}
+
+	return rs.ReturnRepo.Get(ret.ID)
+}
+
+func (rs ReturnService) Get(id int, userID int, role string) (models.ReturnRequest, error) {
+	ret, err := rs.ReturnRepo.Get(id)
+	if err != nil {
+		return models.ReturnRequest{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	if role != models.UserRoleAdmin && ret.UserID != userID {
+		return models.ReturnRequest{}, errors.Wrapf(models.ErrForbidden, "return %d belongs to another user", id)
+	}
+
+	return ret, nil
+}
+
+func (rs ReturnService) GetAll(params models.ReturnsParams) ([]models.ReturnRequest, error) {
+	rets, err := rs.ReturnRepo.GetAll(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return rets, nil
+}
+
+func (rs ReturnService) GetUsersAll(user int) ([]models.ReturnRequest, error) {
+	rets, err := rs.ReturnRepo.GetUsersAll(user)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return rets, nil
+}
+
+func (rs ReturnService) Decide(id int, decision models.ReturnDecision, adminID int) (models.ReturnRequest, error) {
+	ret, err := rs.ReturnRepo.Get(id)
+	if err != nil {
+		return models.ReturnRequest{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	if ret.Status != models.ReturnStatusOpen {
+		return ret, errors.Wrapf(models.ErrBadTransition, "return %d is already %s", id, ret.Status)
+	}
+
+	ret.Status = decision.Status
+	ret.DecidedBy = &adminID
+	ret.Comment = decision.Comment
+
+	if decision.Status == models.ReturnStatusApproved {
+		err = rs.ReturnRepo.Approve(ret)
+	} else {
+		err = rs.ReturnRepo.Reject(ret)
+	}
+	if err != nil {
+		return ret, errors.Wrap(err, "can`t update repo")
+	}
+
+	return rs.ReturnRepo.Get(id)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/el1ljah/cp_db/internal/models"
+)
+
+func TestRefund(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    models.Order
+		returned int
+		refund   int
+	}{
+		{
+			name:     "no discount",
+			order:    models.Order{Price: 3000},
+			returned: 1000,
+			refund:   1000,
+		},
+		{
+			name:     "discount is prorated",
+			order:    models.Order{Price: 2700, Discount: 300},
+			returned: 1000,
+			refund:   900,
+		},
+		{
+			name:     "discount share is rounded up",
+			order:    models.Order{Price: 2900, Discount: 100},
+			returned: 1000,
+			refund:   966,
+		},
+		{
+			name:     "whole order refunds what was charged",
+			order:    models.Order{Price: 2700, Discount: 300},
+			returned: 3000,
+			refund:   2700,
+		},
+		{
+			name:     "capped by earlier refunds",
+			order:    models.Order{Price: 2700, Discount: 300, Refund: 2000},
+			returned: 1000,
+			refund:   700,
+		},
+		{
+			name:     "fixed discount larger than the line",
+			order:    models.Order{Price: 0, Discount: 500},
+			returned: 500,
+			refund:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := refund(tt.order, tt.returned)
+			if got != tt.refund {
+				t.Errorf("refund() = %d, want %d", got, tt.refund)
+			}
+		})
+	}
+}
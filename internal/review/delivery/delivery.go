@@ -0,0 +1,284 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"github.com/pkg/errors"
+)
+
+type ReviewService interface {
+	Create(int, models.ReviewCreate, int) (models.Review, error)
+	GetItemsAll(int) ([]models.Review, error)
+	GetAll(models.ReviewsParams) ([]models.Review, error)
+	Moderate(int, models.ReviewModeration, int) (models.Review, error)
+}
+
+type ContextManager interface {
+	UserIDFromContext(ctx context.Context) (int, error)
+}
+
+type ReviewHandler struct {
+	ReviewService  ReviewService
+	ContextManager ContextManager
+	Logger         logger.Logger
+}
+
+func (rh *ReviewHandler) writeError(w http.ResponseWriter, err error, msg string) {
+	rh.Logger.Infow(msg,
+		"err:", err.Error())
+
+	switch {
+	case errors.Is(err, models.ErrForbidden):
+		http.Error(w, "only customers who received the item can review it", http.StatusForbidden)
+	case errors.Is(err, models.ErrReviewExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, msg, http.StatusBadRequest)
+	}
+}
+
+func (rh *ReviewHandler) writeResponse(w http.ResponseWriter, v interface{}, status int) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		rh.Logger.Errorw("can`t marshal review",
+			"err:", err.Error())
+		http.Error(w, "can`t get review", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		rh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rh *ReviewHandler) pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	vars := mux.Vars(r)
+	idString, ok := vars[name]
+	if !ok {
+		rh.Logger.Errorw("no " + name + " var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(idString)
+	if err != nil {
+		rh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// @Summary      Review delivered item
+// @Tags         reviews
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "ID of reviewed item"
+// @Param 		 review_model body models.ReviewCreate true "rating and text"
+// @Success      201  {object}  models.Review
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /items/{ITEM_ID}/reviews [post]
+func (rh *ReviewHandler) Create(w http.ResponseWriter, r *http.Request) {
+	itemId, ok := rh.pathID(w, r, "ITEM_ID")
+	if !ok {
+		return
+	}
+
+	create := &models.ReviewCreate{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		rh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, create)
+	if err != nil {
+		rh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(create)
+	if err != nil {
+		rh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := rh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	review, err := rh.ReviewService.Create(itemId, *create, userID)
+	if err != nil {
+		rh.writeError(w, err, "can`t create review")
+		return
+	}
+
+	rh.writeResponse(w, review, http.StatusCreated)
+}
+
+// @Summary      Get published reviews of item
+// @Tags         reviews
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "ID of item"
+// @Success      200  {array}  models.Review
+// @Failure      400
+// @Failure      500
+// @Router       /items/{ITEM_ID}/reviews [get]
+func (rh *ReviewHandler) GetItemsAll(w http.ResponseWriter, r *http.Request) {
+	itemId, ok := rh.pathID(w, r, "ITEM_ID")
+	if !ok {
+		return
+	}
+
+	reviews, err := rh.ReviewService.GetItemsAll(itemId)
+	if err != nil {
+		rh.writeError(w, err, "can`t get reviews")
+		return
+	}
+
+	rh.writeResponse(w, reviews, http.StatusOK)
+}
+
+// @Summary      Get all reviews for moderation
+// @Tags         reviews
+// @Accept       json
+// @Produce      json
+// @Param        WhereStatus    query	string  false  "Status опубликован|скрыт|any"
+// @Success      200  {array}  models.Review
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /reviews [get]
+func (rh *ReviewHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		rh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	reviewsParams := new(models.ReviewsParams)
+	err = schema.NewDecoder().Decode(reviewsParams, r.Form)
+	if err != nil {
+		rh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(reviewsParams)
+	if err != nil {
+		rh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := rh.ReviewService.GetAll(*reviewsParams)
+	if err != nil {
+		rh.writeError(w, err, "can`t get reviews")
+		return
+	}
+
+	rh.writeResponse(w, reviews, http.StatusOK)
+}
+
+// @Summary      Publish or hide review
+// @Tags         reviews
+// @Accept       json
+// @Produce      json
+// @Param        REVIEW_ID    path	integer  true  "ID of review"
+// @Param 		 moderation body models.ReviewModeration true "moderation decision"
+// @Success      200  {object}  models.Review
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /reviews/{REVIEW_ID}/moderation [post]
+func (rh *ReviewHandler) Moderate(w http.ResponseWriter, r *http.Request) {
+	reviewId, ok := rh.pathID(w, r, "REVIEW_ID")
+	if !ok {
+		return
+	}
+
+	moderation := &models.ReviewModeration{}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		rh.Logger.Errorw("can`t read body of request",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	err = json.Unmarshal(body, moderation)
+	if err != nil {
+		rh.Logger.Infow("can`t unmarshal form",
+			"err:", err.Error())
+		http.Error(w, "bad  data", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(moderation)
+	if err != nil {
+		rh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := rh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		rh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	review, err := rh.ReviewService.Moderate(reviewId, *moderation, userID)
+	if err != nil {
+		rh.writeError(w, err, "can`t moderate review")
+		return
+	}
+
+	rh.writeResponse(w, review, http.StatusOK)
+}
@@ -0,0 +1,161 @@
+package repo
+
+import (
+	"database/sql"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/querybuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type PgReviewRepo struct {
+	Logger logger.Logger
+	DB     *sqlx.DB
+}
+
+func (prr *PgReviewRepo) HasDelivered(itemID, userID int) (bool, error) {
+	var delivered bool
+
+	err := prr.DB.Get(
+		&delivered,
+		"select exists("+
+			"select 1 from Ordering o "+
+			"join OrderItems oi on oi.order_id = o.id "+
+			"where o.user_id = $1 and oi.item_id = $2 and o.current_status = $3)",
+		userID,
+		itemID,
+		models.OrderStatusDelivered)
+	if err != nil {
+		return false, errors.Wrap(err, "can`t get from db")
+	}
+
+	return delivered, nil
+}
+
+func (prr *PgReviewRepo) Create(review models.Review) (int, error) {
+	tx, err := prr.DB.Beginx()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(
+		"insert into Review (item_id, user_id, rating, review_text, status) "+
+			"values ($1, $2, $3, $4, $5) "+
+			"on conflict (item_id, user_id) do nothing "+
+			"returning id",
+		review.ItemID,
+		review.UserID,
+		review.Rating,
+		review.Text,
+		review.Status,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Wrapf(models.ErrReviewExists, "item %d", review.ItemID)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t insert to db")
+	}
+
+	_, err = tx.Exec("select RefreshItemRating($1)", review.ItemID)
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t refresh item rating in db")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return id, nil
+}
+
+func (prr *PgReviewRepo) Get(id int) (models.Review, error) {
+	review := models.Review{}
+
+	err := prr.DB.Get(
+		&review,
+		"select * "+
+			"from Review "+
+			"where id = $1",
+		id)
+	if err != nil {
+		return review, errors.Wrap(err, "can`t get from db")
+	}
+
+	return review, nil
+}
+
+func (prr *PgReviewRepo) GetItemsAll(itemID int) ([]models.Review, error) {
+	reviews := []models.Review{}
+
+	err := prr.DB.Select(
+		&reviews,
+		"select * "+
+			"from Review "+
+			"where item_id = $1 and status = $2 "+
+			"order by created_at desc, id desc",
+		itemID,
+		models.ReviewStatusPublished)
+	if err != nil {
+		return reviews, errors.Wrap(err, "can`t get from db")
+	}
+
+	return reviews, nil
+}
+
+func (prr *PgReviewRepo) GetAll(params models.ReviewsParams) ([]models.Review, error) {
+	reviews := []models.Review{}
+	sb := querybuilder.Select("*").From("Review")
+
+	if params.WhereStatus != "" && params.WhereStatus != models.ItemsParamsAny {
+		sb.Where("status = ?", params.WhereStatus)
+	}
+
+	query, args := sb.OrderBy("created_at desc").OrderBy("id desc").Build()
+
+	err := prr.DB.Select(&reviews, query, args...)
+	if err != nil {
+		return reviews, errors.Wrap(err, "can`t get from db")
+	}
+
+	return reviews, nil
+}
+
+func (prr *PgReviewRepo) Moderate(review models.Review) error {
+	tx, err := prr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"update Review "+
+			"set status = $1, "+
+			"moderated_by = $2, "+
+			"moderated_at = now(), "+
+			"moderator_comment = $3 "+
+			"where id = $4",
+		review.Status,
+		review.ModeratedBy,
+		review.ModeratorComment,
+		review.ID)
+	if err != nil {
+		return errors.Wrap(err, "can`t update table in db")
+	}
+
+	_, err = tx.Exec("select RefreshItemRating($1)", review.ItemID)
+	if err != nil {
+		return errors.Wrap(err, "can`t refresh item rating in db")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+type ReviewRepo interface {
+	HasDelivered(int, int) (bool, error)
+	Create(models.Review) (int, error)
+	Get(int) (models.Review, error)
+	GetItemsAll(int) ([]models.Review, error)
+	GetAll(models.ReviewsParams) ([]models.Review, error)
+	Moderate(models.Review) error
+}
+
+type ReviewService struct {
+	ReviewRepo ReviewRepo
+	Logger     logger.Logger
+}
+
+func (rs ReviewService) Create(itemID int, create models.ReviewCreate, userID int) (models.Review, error) {
+	if create.Rating < 1 || create.Rating > 5 {
+		return models.Review{}, errors.Errorf("rating must be from 1 to 5, got %d", create.Rating)
+	}
+
+	delivered, err := rs.ReviewRepo.HasDelivered(itemID, userID)
+	if err != nil {
+		return models.Review{}, errors.Wrap(err, "can`t get orders from repo")
+	}
+
+	if !delivered {
+		return models.Review{}, errors.Wrapf(models.ErrForbidden, "user %d has no delivered order with item %d", userID, itemID)
+	}
+
+	review := models.Review{
+		ItemID: itemID,
+		UserID: userID,
+		Rating: create.Rating,
+		Text:   create.Text,
+		Status: models.ReviewStatusPublished,
+	}
+
+	review.ID, err = rs.ReviewRepo.Create(review)
+	if err != nil {
+		return models.Review{}, errors.Wrap(err, "can`t add to repo")
+	}
+
+	return rs.ReviewRepo.Get(review.ID)
+}
+
+func (rs ReviewService) GetItemsAll(itemID int) ([]models.Review, error) {
+	reviews, err := rs.ReviewRepo.GetItemsAll(itemID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return reviews, nil
+}
+
+func (rs ReviewService) GetAll(params models.ReviewsParams) ([]models.Review, error) {
+	reviews, err := rs.ReviewRepo.GetAll(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	return reviews, nil
+}
+
+func (rs ReviewService) Moderate(id int, moderation models.ReviewModeration, adminID int) (models.Review, error) {
+	review, err := rs.ReviewRepo.Get(id)
+	if err != nil {
+		return models.Review{}, errors.Wrap(err, "can`t get from repo")
+	}
+
+	review.Status = moderation.Status
+	review.ModeratedBy = &adminID
+	review.ModeratorComment = moderation.Comment
+
+	err = rs.ReviewRepo.Moderate(review)
+	if err != nil {
+		return review, errors.Wrap(err, "can`t update repo")
+	}
+
+	return rs.ReviewRepo.Get(id)
+}
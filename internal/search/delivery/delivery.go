@@ -0,0 +1,86 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/schema"
+)
+
+type SearchService interface {
+	Suggest(models.SuggestParams) (models.Suggestions, error)
+}
+
+type SearchHandler struct {
+	SearchService SearchService
+	Logger        logger.Logger
+}
+
+// @Summary      Suggest brands, categories and items while typing
+// @Description  Tolerates wrong keyboard layout and latin transliteration
+// @Tags         search
+// @Accept       json
+// @Produce      json
+// @Param        q    query	string  true  "Typed text"
+// @Success      200  {object}  models.Suggestions
+// @Failure      400
+// @Failure      500
+// @Router       /search/suggest [get]
+func (sh *SearchHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		sh.Logger.Errorw("can`t parse form",
+			"err:", err.Error())
+		http.Error(w, "can`t parse form", http.StatusBadRequest)
+		return
+	}
+
+	suggestParams := new(models.SuggestParams)
+	err = schema.NewDecoder().Decode(suggestParams, r.Form)
+	if err != nil {
+		sh.Logger.Infow("can`t decode form to struct",
+			"err:", err.Error())
+		http.Error(w, "can`t decode form to struct", http.StatusBadRequest)
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(suggestParams)
+	if err != nil {
+		sh.Logger.Infow("can`t validate form",
+			"err:", err.Error())
+		http.Error(w, "can`t validate form", http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := sh.SearchService.Suggest(*suggestParams)
+	if err != nil {
+		sh.Logger.Infow("can`t get suggestions",
+			"err:", err.Error())
+		http.Error(w, "can`t get suggestions", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := json.Marshal(suggestions)
+
+	if err != nil {
+		sh.Logger.Errorw("can`t marshal suggestions",
+			"err:", err.Error())
+		http.Error(w, "can`t get suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		sh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
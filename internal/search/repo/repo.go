@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// suggestQuery matches the search terms against one text column of from: a
+// prefix of the whole text or of any word in it scores 1, otherwise the
+// trigram word similarity is used. Every term gets a branch of its own that
+// compares the column with plain parameters, so the trigram indexes can
+// serve it, and rows found by several terms or sharing a label are merged.
+// $1 is the limit, each term and its prefix take two parameters starting
+// from first.
+func suggestQuery(id, text, from string, terms, first int) string {
+	lower := "lower(" + text + ")"
+	branches := make([]string, 0, terms)
+
+	for i := 0; i < terms; i++ {
+		term := "$" + strconv.Itoa(first+2*i) + "::text"
+		prefix := "$" + strconv.Itoa(first+2*i+1) + "::text"
+
+		branches = append(branches, "select "+id+" as id, "+text+" as label, "+
+			"case when "+lower+" like "+prefix+" or "+lower+" like '% ' || "+prefix+" "+
+			"then 1 else word_similarity("+term+", "+lower+") end as score "+
+			"from "+from+" "+
+			"where "+lower+" like "+prefix+" "+
+			"or "+lower+" like '% ' || "+prefix+" "+
+			"or "+lower+" %> "+term)
+	}
+
+	return "select min(s.id) as id, s.label, max(s.score) as score " +
+		"from (" + strings.Join(branches, " union all ") + ") s " +
+		"group by s.label " +
+		"order by score desc, s.label " +
+		"limit $1"
+}
+
+type PgSearchRepo struct {
+	Logger logger.Logger
+	DB     *sqlx.DB
+}
+
+// suggest runs suggestQuery with the limit and the extra arguments of from
+// ahead of the terms.
+func (psr *PgSearchRepo) suggest(id, text, from string, terms, prefixes []string, limit int, extra ...interface{}) ([]models.Suggestion, error) {
+	suggestions := []models.Suggestion{}
+
+	args := append([]interface{}{limit}, extra...)
+	query := suggestQuery(id, text, from, len(terms), len(args)+1)
+
+	for i, term := range terms {
+		args = append(args, term, prefixes[i])
+	}
+
+	psr.Logger.Debugw("PgSearchRepo.suggest()", "query", query, "args", args)
+	err := psr.DB.Select(&suggestions, query, args...)
+	if err != nil {
+		return suggestions, errors.Wrap(err, "can`t get from db")
+	}
+
+	return suggestions, nil
+}
+
+func (psr *PgSearchRepo) SuggestBrands(terms, prefixes []string, limit int) ([]models.Suggestion, error) {
+	return psr.suggest("b.id", "b.brand_name", "(select * from Brand where not archived) b", terms, prefixes, limit)
+}
+
+func (psr *PgSearchRepo) SuggestItems(terms, prefixes []string, limit int) ([]models.Suggestion, error) {
+	return psr.suggest("i.id", "i.title", "Item i join Brand b on b.id = i.brand_id and not b.archived", terms, prefixes, limit)
+}
+
+func (psr *PgSearchRepo) SuggestCategories(terms, prefixes []string, limit int) ([]models.Suggestion, error) {
+	return psr.suggest("0", "c.category", "unnest($2::text[]) as c(category)",
+		terms, prefixes, limit, pq.Array(models.ItemCategories))
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+type SearchRepo interface {
+	SuggestBrands([]string, []string, int) ([]models.Suggestion, error)
+	SuggestCategories([]string, []string, int) ([]models.Suggestion, error)
+	SuggestItems([]string, []string, int) ([]models.Suggestion, error)
+}
+
+type SearchService struct {
+	SearchRepo SearchRepo
+	Logger     logger.Logger
+}
+
+const (
+	latinLayout    = "`qwertyuiop[]asdfghjkl;'zxcvbnm,."
+	cyrillicLayout = "ёйцукенгшщзхъфывапролджэячсмитьбю"
+)
+
+var (
+	latinToCyrillicLayout = layoutMap(latinLayout, cyrillicLayout)
+	cyrillicToLatinLayout = layoutMap(cyrillicLayout, latinLayout)
+)
+
+// latinToCyrillic lists digraphs before single letters so that the longest
+// match wins.
+var latinToCyrillic = strings.NewReplacer(
+	"shch", "щ", "sch", "щ",
+	"zh", "ж", "kh", "х", "ts", "ц", "ch", "ч", "sh", "ш",
+	"yo", "ё", "yu", "ю", "ya", "я",
+	"a", "а", "b", "б", "c", "к", "d", "д", "e", "е", "f", "ф", "g", "г",
+	"h", "х", "i", "и", "j", "й", "k", "к", "l", "л", "m", "м", "n", "н",
+	"o", "о", "p", "п", "q", "к", "r", "р", "s", "с", "t", "т", "u", "у",
+	"v", "в", "w", "в", "x", "кс", "y", "ы", "z", "з",
+)
+
+var cyrillicToLatin = strings.NewReplacer(
+	"а", "a", "б", "b", "в", "v", "г", "g", "д", "d", "е", "e", "ё", "yo",
+	"ж", "zh", "з", "z", "и", "i", "й", "y", "к", "k", "л", "l", "м", "m",
+	"н", "n", "о", "o", "п", "p", "р", "r", "с", "s", "т", "t", "у", "u",
+	"ф", "f", "х", "kh", "ц", "ts", "ч", "ch", "ш", "sh", "щ", "shch", "ъ", "",
+	"ы", "y", "ь", "", "э", "e", "ю", "yu", "я", "ya",
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func layoutMap(from, to string) map[rune]rune {
+	fromRunes, toRunes := []rune(from), []rune(to)
+	m := make(map[rune]rune, len(fromRunes))
+
+	for i, r := range fromRunes {
+		m[r] = toRunes[i]
+	}
+
+	return m
+}
+
+func switchLayout(s string, layout map[rune]rune) string {
+	return strings.Map(func(r rune) rune {
+		if switched, ok := layout[r]; ok {
+			return switched
+		}
+
+		return r
+	}, s)
+}
+
+// searchTerms returns the query as typed together with its keyboard layout
+// and transliteration variants, so "rhjccjdrb" and "krossovki" both find
+// "кроссовки".
+func searchTerms(q string) []string {
+	q = strings.ToLower(strings.TrimSpace(q))
+
+	candidates := []string{
+		q,
+		switchLayout(q, latinToCyrillicLayout),
+		switchLayout(q, cyrillicToLatinLayout),
+		latinToCyrillic.Replace(q),
+		cyrillicToLatin.Replace(q),
+	}
+
+	terms := []string{}
+	seen := map[string]bool{}
+
+	for _, term := range candidates {
+		if term == "" || seen[term] {
+			continue
+		}
+
+		seen[term] = true
+		terms = append(terms, term)
+	}
+
+	return terms
+}
+
+func (ss SearchService) Suggest(params models.SuggestParams) (models.Suggestions, error) {
+	terms := searchTerms(params.Q)
+	if len(terms) == 0 {
+		return models.Suggestions{}, errors.New("empty search query")
+	}
+
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, likeEscaper.Replace(term)+"%")
+	}
+
+	var (
+		suggestions models.Suggestions
+		err         error
+	)
+
+	suggestions.Brands, err = ss.SearchRepo.SuggestBrands(terms, prefixes, models.SuggestLimit)
+	if err != nil {
+		return models.Suggestions{}, errors.Wrap(err, "can`t get brands from repo")
+	}
+
+	suggestions.Categories, err = ss.SearchRepo.SuggestCategories(terms, prefixes, models.SuggestLimit)
+	if err != nil {
+		return models.Suggestions{}, errors.Wrap(err, "can`t get categories from repo")
+	}
+
+	suggestions.Items, err = ss.SearchRepo.SuggestItems(terms, prefixes, models.SuggestLimit)
+	if err != nil {
+		return models.Suggestions{}, errors.Wrap(err, "can`t get items from repo")
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     string
+		terms []string
+	}{
+		{
+			name:  "transliterated latin",
+			q:     "krossovki",
+			terms: []string{"krossovki", "лкщыыщмлш", "кроссовки"},
+		},
+		{
+			name:  "cyrillic typed in latin layout",
+			q:     "rhjccjdrb",
+			terms: []string{"rhjccjdrb", "кроссовки", "рхйккйдрб"},
+		},
+		{
+			name:  "cyrillic",
+			q:     "кроссовки",
+			terms: []string{"кроссовки", "rhjccjdrb", "krossovki"},
+		},
+		{
+			name:  "trimmed and lowered",
+			q:     "  Nike ",
+			terms: []string{"nike", "тшлу", "нике"},
+		},
+		{
+			name:  "longest digraph wins",
+			q:     "shchuka",
+			terms: []string{"shchuka", "ырсрглф", "щука"},
+		},
+		{
+			name:  "layout punctuation is switched",
+			q:     "[]",
+			terms: []string{"[]", "хъ"},
+		},
+		{
+			name:  "duplicates are dropped",
+			q:     "123",
+			terms: []string{"123"},
+		},
+		{
+			name:  "empty query",
+			q:     "",
+			terms: []string{},
+		},
+		{
+			name:  "blank query",
+			q:     "   ",
+			terms: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		terms := searchTerms(test.q)
+		if !reflect.DeepEqual(terms, test.terms) {
+			t.Errorf("%s: searchTerms(%q) = %q, want %q", test.name, test.q, terms, test.terms)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/el1ljah/cp_db/internal/models"
 	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/el1ljah/cp_db/pkg/middleware"
 
 	"github.com/asaskevich/govalidator"
 )
@@ -27,12 +28,38 @@ type UserService interface {
 
 type SessionManager interface {
 	CreateSession(int, string) (string, error)
+	GetGuestBasket(string) (int, error)
+}
+
+type BasketMerger interface {
+	MergeGuest(int, int) error
 }
 
 type UserHandler struct {
 	UserService UserService
 	Logger      logger.Logger
 	Sessions    SessionManager
+	Baskets     BasketMerger
+}
+
+func (uh *UserHandler) mergeGuestBasket(r *http.Request, userID int) {
+	token := r.Header.Get(middleware.GuestHeader)
+	if token == "" {
+		return
+	}
+
+	basketID, err := uh.Sessions.GetGuestBasket(token)
+	if err != nil {
+		uh.Logger.Infow("can`t get guest basket from token",
+			"err:", err.Error())
+		return
+	}
+
+	err = uh.Baskets.MergeGuest(basketID, userID)
+	if err != nil {
+		uh.Logger.Errorw("can`t merge guest basket",
+			"err:", err.Error())
+	}
 }
 
 // @Summary      Registration
@@ -40,6 +67,7 @@ type UserHandler struct {
 // @Accept       json
 // @Produce      json
 // @Param        registerForm    body	models.User  true  "Registration"
+// @Param        X-Guest-Token    header	string  false  "Guest token of basket to merge"
 // @Success      200  
 // @Failure      400
 // @Failure      401
@@ -89,6 +117,8 @@ func (uh *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	uh.mergeGuestBasket(r, user.ID)
+
 	token, err := uh.Sessions.CreateSession(user.ID, "user")
 	if err != nil {
 		uh.Logger.Errorw("can`t create session",
@@ -123,6 +153,7 @@ func (uh *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 // @Accept       json
 // @Produce      json
 // @Param        loginForm    body	loginForm  true  "Login form"
+// @Param        X-Guest-Token    header	string  false  "Guest token of basket to merge"
 // @Success      200  
 // @Failure      400
 // @Failure      401
@@ -165,6 +196,8 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	uh.mergeGuestBasket(r, user.ID)
+
 	token, err := uh.Sessions.CreateSession(user.ID, user.Role)
 	if err != nil {
 		uh.Logger.Errorw("can`t create session",
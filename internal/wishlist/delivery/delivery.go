@@ -0,0 +1,214 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type WishlistService interface {
+	Get(int) ([]models.WishlistItem, error)
+	Add(int, int) ([]models.WishlistItem, error)
+	Remove(int, int) ([]models.WishlistItem, error)
+	MoveToBasket(int, int) ([]models.WishlistItem, error)
+}
+
+type ContextManager interface {
+	UserIDFromContext(ctx context.Context) (int, error)
+}
+
+type WishlistHandler struct {
+	WishlistService WishlistService
+	Logger          logger.Logger
+	ContextManager  ContextManager
+}
+
+// @Summary      Get items in wishlist
+// @Tags         wishlist
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}  models.WishlistItem
+// @Failure      400
+// @Failure      401
+// @Failure      403
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /wishlist [get]
+func (wh *WishlistHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, err := wh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	items, err := wh.WishlistService.Get(userID)
+	if err != nil {
+		wh.Logger.Infow("can`t get wishlist",
+			"err:", err.Error())
+		http.Error(w, "can`t get wishlist", http.StatusBadRequest)
+		return
+	}
+
+	wh.writeWishlist(w, items, http.StatusOK)
+}
+
+// @Summary      Add item to wishlist
+// @Tags         wishlist
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "ID of item adding to wishlist"
+// @Success      200  {array}  models.WishlistItem
+// @Failure      400
+// @Failure      401
+// @Failure      404
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /wishlist/{ITEM_ID} [post]
+func (wh *WishlistHandler) Add(w http.ResponseWriter, r *http.Request) {
+	itemID, userID, ok := wh.itemAndUser(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := wh.WishlistService.Add(itemID, userID)
+	if errors.Is(err, models.ErrItemNotAvailable) {
+		wh.Logger.Infow("can`t add item to wishlist (no such item)",
+			"err:", err.Error())
+		http.Error(w, "no such item", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		wh.Logger.Infow("can`t add item to wishlist",
+			"err:", err.Error())
+		http.Error(w, "can`t add item to wishlist", http.StatusBadRequest)
+		return
+	}
+
+	wh.writeWishlist(w, items, http.StatusOK)
+}
+
+// @Summary      Remove item from wishlist
+// @Tags         wishlist
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "ID of item removing from wishlist"
+// @Success      200  {array}  models.WishlistItem
+// @Failure      400
+// @Failure      401
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /wishlist/{ITEM_ID} [delete]
+func (wh *WishlistHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	itemID, userID, ok := wh.itemAndUser(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := wh.WishlistService.Remove(itemID, userID)
+	if err != nil {
+		wh.Logger.Infow("can`t remove item from wishlist",
+			"err:", err.Error())
+		http.Error(w, "can`t remove item from wishlist", http.StatusBadRequest)
+		return
+	}
+
+	wh.writeWishlist(w, items, http.StatusOK)
+}
+
+// @Summary      Move item from wishlist to basket
+// @Tags         wishlist
+// @Accept       json
+// @Produce      json
+// @Param        ITEM_ID    path	integer  true  "ID of item moving to basket"
+// @Success      200  {array}  models.WishlistItem
+// @Failure      400
+// @Failure      401
+// @Failure      409
+// @Failure      500
+// @Security ApiKeyAuth
+// @Router       /wishlist/{ITEM_ID}/basket [post]
+func (wh *WishlistHandler) MoveToBasket(w http.ResponseWriter, r *http.Request) {
+	itemID, userID, ok := wh.itemAndUser(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := wh.WishlistService.MoveToBasket(itemID, userID)
+	if errors.Is(err, models.ErrOutOfStock) {
+		wh.Logger.Infow("can`t move item to basket (not enough items in stock)",
+			"err:", err.Error())
+		http.Error(w, "can`t move item to basket (not enough items in stock)", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrItemNotAvailable) {
+		wh.Logger.Infow("can`t move item to basket (item is not available)",
+			"err:", err.Error())
+		http.Error(w, "can`t move item to basket (item is not available)", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		wh.Logger.Infow("can`t move item to basket",
+			"err:", err.Error())
+		http.Error(w, "can`t move item to basket", http.StatusBadRequest)
+		return
+	}
+
+	wh.writeWishlist(w, items, http.StatusOK)
+}
+
+func (wh *WishlistHandler) itemAndUser(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	itemIdString, ok := vars["ITEM_ID"]
+	if !ok {
+		wh.Logger.Errorw("no ITEM_ID var")
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+
+	itemId, err := strconv.Atoi(itemIdString)
+	if err != nil {
+		wh.Logger.Errorw("fail to convert id to int",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+
+	userID, err := wh.ContextManager.UserIDFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Errorw("fail to get id from context",
+			"err:", err.Error())
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+
+	return itemId, userID, true
+}
+
+func (wh *WishlistHandler) writeWishlist(w http.ResponseWriter, items []models.WishlistItem, status int) {
+	resp, err := json.Marshal(items)
+	if err != nil {
+		wh.Logger.Errorw("can`t marshal wishlist",
+			"err:", err.Error())
+		http.Error(w, "can`t get wishlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		wh.Logger.Errorw("can`t write response",
+			"err:", err.Error())
+		http.Error(w, "can`t write response", http.StatusInternalServerError)
+		return
+	}
+}
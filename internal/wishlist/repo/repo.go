@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type PgWishlistRepo struct {
+	Logger logger.Logger
+	DB     *sqlx.DB
+}
+
+func (pwr *PgWishlistRepo) Get(userID int) ([]models.WishlistItem, error) {
+	items := []models.WishlistItem{}
+
+	err := pwr.DB.Select(
+		&items,
+		"select i.id, i.category, i.size, i.price, i.sex, i.image_id, i.brand_id, "+
+			"i.is_available and not b.archived as is_available, "+
+			"i.stock, i.reserved, i.rating, i.review_count, i.title, i.description, "+
+			"b.brand_name, w.added_at, "+
+			"exists(select 1 from Image im where im.id = i.image_id) as has_image, "+
+			"array(select v.variant from ImageVariant v where v.image_id = i.image_id) as image_variant_names "+
+			"from Wishlist w "+
+			"join Item i on w.item_id = i.id "+
+			"join Brand b on i.brand_id = b.id "+
+			"where w.user_id = $1 "+
+			"order by w.added_at desc, w.id desc",
+		userID)
+	if err != nil {
+		return items, errors.Wrap(err, "can`t get from db")
+	}
+
+	return items, nil
+}
+
+func (pwr *PgWishlistRepo) Add(itemID, userID int) error {
+	var exists bool
+
+	err := pwr.DB.Get(
+		&exists,
+		"select exists(select 1 from Item where id = $1)",
+		itemID)
+	if err != nil {
+		return errors.Wrap(err, "can`t get from db")
+	}
+
+	if !exists {
+		return errors.Wrapf(models.ErrItemNotAvailable, "no item %d", itemID)
+	}
+
+	_, err = pwr.DB.Exec(
+		"insert into Wishlist (user_id, item_id) "+
+			"values ($1, $2) "+
+			"on conflict (user_id, item_id) do nothing",
+		userID,
+		itemID)
+	if err != nil {
+		return errors.Wrap(err, "can`t insert to db")
+	}
+
+	return nil
+}
+
+func (pwr *PgWishlistRepo) Remove(itemID, userID int) error {
+	res, err := pwr.DB.Exec(
+		"delete from Wishlist "+
+			"where user_id = $1 and item_id = $2",
+		userID,
+		itemID)
+	if err != nil {
+		return errors.Wrap(err, "can`t delete from db")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected == 0 {
+		return errors.Errorf("item %d is not in wishlist", itemID)
+	}
+
+	return nil
+}
+
+// MoveToBasket puts one unit of the item in the user's basket and drops it
+// from the wishlist in the same transaction.
+func (pwr *PgWishlistRepo) MoveToBasket(itemID, userID int) error {
+	tx, err := pwr.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "can`t begin transaction")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"delete from Wishlist "+
+			"where user_id = $1 and item_id = $2",
+		userID,
+		itemID)
+	if err != nil {
+		return errors.Wrap(err, "can`t delete from db")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "can`t get affected rows")
+	}
+
+	if affected == 0 {
+		return errors.Errorf("item %d is not in wishlist", itemID)
+	}
+
+	var added int
+	err = tx.Get(
+		&added,
+		"SELECT AddItemUsersBasket($1, $2, $3)", itemID, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "can`t add item in basket in db")
+	}
+
+	if added == 1 {
+		return errors.Wrapf(models.ErrItemNotAvailable, "can`t put item %d in basket", itemID)
+	} else if added == 2 {
+		return errors.Wrapf(models.ErrOutOfStock, "can`t put item %d in basket", itemID)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can`t commit transaction")
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/el1ljah/cp_db/internal/models"
+	"github.com/el1ljah/cp_db/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+type WishlistRepo interface {
+	Get(int) ([]models.WishlistItem, error)
+	Add(int, int) error
+	Remove(int, int) error
+	MoveToBasket(int, int) error
+}
+
+type WishlistService struct {
+	WishlistRepo WishlistRepo
+	Logger       logger.Logger
+}
+
+func (ws WishlistService) Get(userID int) ([]models.WishlistItem, error) {
+	items, err := ws.WishlistRepo.Get(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get from repo")
+	}
+
+	for i := range items {
+		items[i].SetImageURLs()
+	}
+
+	return items, nil
+}
+
+func (ws WishlistService) Add(itemID, userID int) ([]models.WishlistItem, error) {
+	err := ws.WishlistRepo.Add(itemID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t add item in repo")
+	}
+
+	return ws.Get(userID)
+}
+
+func (ws WishlistService) Remove(itemID, userID int) ([]models.WishlistItem, error) {
+	err := ws.WishlistRepo.Remove(itemID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t remove item in repo")
+	}
+
+	return ws.Get(userID)
+}
+
+func (ws WishlistService) MoveToBasket(itemID, userID int) ([]models.WishlistItem, error) {
+	err := ws.WishlistRepo.MoveToBasket(itemID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t move item to basket in repo")
+	}
+
+	return ws.Get(userID)
+}
@@ -0,0 +1,17 @@
+package blobstore
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps opaque blobs under flat keys. Keys are chosen by the caller and
+// must not contain path separators.
+type Store interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
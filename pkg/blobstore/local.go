@@ -0,0 +1,91 @@
+package blobstore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LocalStore keeps every blob as a file in Dir.
+type LocalStore struct {
+	Dir string
+}
+
+func (ls LocalStore) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", errors.Errorf("bad blob key %q", key)
+	}
+
+	return filepath.Join(ls.Dir, key), nil
+}
+
+// Put writes the blob to a temporary file first, so a failed upload never
+// leaves a truncated blob under the key.
+func (ls LocalStore) Put(key string, r io.Reader) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(ls.Dir, 0o755)
+	if err != nil {
+		return errors.Wrap(err, "can`t create blob dir")
+	}
+
+	tmp, err := os.CreateTemp(ls.Dir, ".upload-*")
+	if err != nil {
+		return errors.Wrap(err, "can`t create blob file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "can`t write blob file")
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrap(err, "can`t write blob file")
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return errors.Wrap(err, "can`t move blob file")
+	}
+
+	return nil
+}
+
+func (ls LocalStore) Open(key string) (io.ReadCloser, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "no blob %q", key)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "can`t open blob file")
+	}
+
+	return file, nil
+}
+
+func (ls LocalStore) Delete(key string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "can`t remove blob file")
+	}
+
+	return nil
+}
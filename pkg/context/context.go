@@ -8,7 +8,11 @@ import (
 
 type contextKeyType string
 
-const contextUserKey contextKeyType = "contextUserKey"
+const (
+	contextUserKey     contextKeyType = "contextUserKey"
+	contextUserRoleKey contextKeyType = "contextUserRoleKey"
+	contextGuestKey    contextKeyType = "contextGuestKey"
+)
 
 type ContextManager struct{}
 
@@ -24,3 +28,29 @@ func (cu *ContextManager) UserIDFromContext(ctx context.Context) (int, error) {
 
 	return user, nil
 }
+
+func (cu ContextManager) ContextWithUserRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, contextUserRoleKey, role)
+}
+
+func (cu *ContextManager) UserRoleFromContext(ctx context.Context) (string, error) {
+	role, ok := ctx.Value(contextUserRoleKey).(string)
+	if !ok {
+		return "", errors.Errorf("can`t get user role from context")
+	}
+
+	return role, nil
+}
+
+func (cu ContextManager) ContextWithGuestBasketID(ctx context.Context, basketID int) context.Context {
+	return context.WithValue(ctx, contextGuestKey, basketID)
+}
+
+func (cu *ContextManager) GuestBasketIDFromContext(ctx context.Context) (int, error) {
+	basketID, ok := ctx.Value(contextGuestKey).(int)
+	if !ok {
+		return -1, errors.Errorf("can`t get guest basket from context")
+	}
+
+	return basketID, nil
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/el1ljah/cp_db/pkg/logger"
+)
+
+const GuestHeader = "X-Guest-Token"
+
+type GuestSessionsManager interface {
+	GetGuestBasket(string) (int, error)
+}
+
+type GuestContextManager interface {
+	ContextWithGuestBasketID(context.Context, int) context.Context
+}
+
+type GuestManager struct {
+	SessionManager GuestSessionsManager
+	Logger         logger.Logger
+	ContextManager GuestContextManager
+}
+
+func (gm *GuestManager) Guest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(GuestHeader)
+		if token == "" {
+			gm.Logger.Infow("guest authoriztion",
+				"url", r.URL.Path,
+				"method", r.Method,
+				"remote_addr", r.RemoteAddr,
+				"auth result", "guest header not found")
+
+			http.Error(w, "no guest token", http.StatusUnauthorized)
+			return
+		}
+
+		basketID, err := gm.SessionManager.GetGuestBasket(token)
+		if err != nil {
+			gm.Logger.Infow("guest authoriztion",
+				"url", r.URL.Path,
+				"method", r.Method,
+				"remote_addr", r.RemoteAddr,
+				"auth result", "guest basket not found",
+				"GetGuestBasket error", err)
+
+			http.Error(w, "no guest token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := gm.ContextManager.ContextWithGuestBasketID(r.Context(), basketID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,125 @@
+// Package pagination encodes opaque page cursors and writes the response
+// headers that describe the next page of a listing.
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	CursorParam  = "cursor"
+	PageNumParam = "Page_num"
+	HeaderCursor = "X-Next-Cursor"
+	HeaderTotal  = "X-Total-Count"
+	HeaderLink   = "Link"
+	DefaultSize  = 20
+	MaxSize      = 100
+)
+
+var ErrBadCursor = errors.New("cursor is not valid")
+
+// Cursor points right after the last row of a page: either at the sort key
+// values of that row (keyset) or, for orderings that can`t be sought, at a
+// row offset. It remembers the ordering and direction it was made for.
+type Cursor struct {
+	OrderBy string        `json:"b,omitempty"`
+	Order   string        `json:"d,omitempty"`
+	Values  []interface{} `json:"v,omitempty"`
+	Offset  int           `json:"o,omitempty"`
+}
+
+func Encode(cursor Cursor) string {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode keeps numbers as json.Number so key values reach the database
+// exactly as they were read.
+func Decode(s string) (Cursor, error) {
+	cursor := Cursor{}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errors.Wrapf(ErrBadCursor, "bad encoding: %s", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&cursor)
+	if err != nil {
+		return cursor, errors.Wrap(ErrBadCursor, err.Error())
+	}
+
+	if cursor.Offset < 0 {
+		return cursor, errors.Wrapf(ErrBadCursor, "offset %d", cursor.Offset)
+	}
+
+	return cursor, nil
+}
+
+// DecodeKeys decodes a cursor of a listing sorted by orderBy in the order
+// direction on the given number of keys, 0 for listings paginated by offset.
+// A cursor made for another ordering is refused instead of seeking by the
+// wrong columns.
+func DecodeKeys(s, orderBy, order string, keys int) (Cursor, error) {
+	cursor, err := Decode(s)
+	if err != nil {
+		return cursor, err
+	}
+
+	if cursor.OrderBy != orderBy || cursor.Order != order {
+		return cursor, errors.Wrapf(ErrBadCursor, "made for order %q %q, not %q %q", cursor.OrderBy, cursor.Order, orderBy, order)
+	}
+
+	if len(cursor.Values) != keys || (keys > 0 && cursor.Offset != 0) {
+		return cursor, errors.Wrapf(ErrBadCursor, "%d values for %d sort keys", len(cursor.Values), keys)
+	}
+
+	return cursor, nil
+}
+
+// Size returns the page size to use for the requested one.
+func Size(size int) int {
+	if size <= 0 {
+		return DefaultSize
+	}
+	if size > MaxSize {
+		return MaxSize
+	}
+
+	return size
+}
+
+// WriteHeaders sets the next cursor, the total count when it was asked for and
+// an RFC 5988 Link header pointing at the next page. It must be called before
+// WriteHeader.
+func WriteHeaders(w http.ResponseWriter, r *http.Request, next string, total *int) {
+	if total != nil {
+		w.Header().Set(HeaderTotal, strconv.Itoa(*total))
+	}
+
+	if next == "" {
+		return
+	}
+
+	w.Header().Set(HeaderCursor, next)
+
+	u := *r.URL
+	query := u.Query()
+	query.Set(CursorParam, next)
+	query.Del(PageNumParam)
+	u.RawQuery = query.Encode()
+
+	w.Header().Set(HeaderLink, "<"+u.RequestURI()+`>; rel="next"`)
+}
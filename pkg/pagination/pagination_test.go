@@ -0,0 +1,72 @@
+package pagination
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	byName := Encode(Cursor{OrderBy: "name", Order: "asc", Values: []interface{}{"nike", 3}})
+	byOffset := Encode(Cursor{OrderBy: "relevance", Offset: 40})
+
+	tests := []struct {
+		name    string
+		cursor  string
+		orderBy string
+		order   string
+		keys    int
+		bad     bool
+	}{
+		{
+			name:    "same ordering",
+			cursor:  byName,
+			orderBy: "name", order: "asc", keys: 2,
+		},
+		{
+			name:    "offset cursor",
+			cursor:  byOffset,
+			orderBy: "relevance", keys: 0,
+		},
+		{
+			name:    "another ordering with as many keys",
+			cursor:  byName,
+			orderBy: "year", order: "asc", keys: 2,
+			bad: true,
+		},
+		{
+			name:    "another direction",
+			cursor:  byName,
+			orderBy: "name", order: "desc", keys: 2,
+			bad: true,
+		},
+		{
+			name:    "another number of keys",
+			cursor:  byName,
+			orderBy: "name", order: "asc", keys: 1,
+			bad: true,
+		},
+		{
+			name:    "offset cursor for a keyset",
+			cursor:  byOffset,
+			orderBy: "relevance", keys: 1,
+			bad: true,
+		},
+		{
+			name:    "not a cursor",
+			cursor:  "!!!",
+			orderBy: "name", order: "asc", keys: 2,
+			bad: true,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := DecodeKeys(test.cursor, test.orderBy, test.order, test.keys)
+		if test.bad && !errors.Is(err, ErrBadCursor) {
+			t.Errorf("%s: err = %v, want ErrBadCursor", test.name, err)
+		}
+		if !test.bad && err != nil {
+			t.Errorf("%s: unexpected err %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package querybuilder assembles select statements whose values are always
+// bound through numbered placeholders.
+//
+// Conditions and expressions are written with "?" in place of every value;
+// Build renumbers them to $1, $2, ... in the order they appear in the final
+// statement, so pieces can be added in any order. A "?" is always treated as
+// a placeholder, so literals must not contain one.
+package querybuilder
+
+import (
+	"strconv"
+	"strings"
+)
+
+type part struct {
+	sql  string
+	args []interface{}
+}
+
+type SelectBuilder struct {
+	columns string
+	from    string
+	joins   []string
+	where   []part
+	groupBy []string
+	orderBy []part
+	limit   *int
+	offset  *int
+}
+
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: strings.Join(columns, ", ")}
+}
+
+func (sb *SelectBuilder) From(from string) *SelectBuilder {
+	sb.from = from
+	return sb
+}
+
+func (sb *SelectBuilder) Join(join string) *SelectBuilder {
+	sb.joins = append(sb.joins, join)
+	return sb
+}
+
+// Where adds a condition; all conditions are joined with "and".
+func (sb *SelectBuilder) Where(cond string, args ...interface{}) *SelectBuilder {
+	sb.where = append(sb.where, part{cond, args})
+	return sb
+}
+
+// WhereIn adds "column = any(?)" with values bound as one array argument.
+// Callers pass values already wrapped for the driver, e.g. pq.Array.
+func (sb *SelectBuilder) WhereIn(column string, values interface{}) *SelectBuilder {
+	return sb.Where(column+" = any(?)", values)
+}
+
+func (sb *SelectBuilder) GroupBy(exprs ...string) *SelectBuilder {
+	sb.groupBy = append(sb.groupBy, exprs...)
+	return sb
+}
+
+func (sb *SelectBuilder) OrderBy(expr string, args ...interface{}) *SelectBuilder {
+	sb.orderBy = append(sb.orderBy, part{expr, args})
+	return sb
+}
+
+func (sb *SelectBuilder) Limit(limit int) *SelectBuilder {
+	sb.limit = &limit
+	return sb
+}
+
+func (sb *SelectBuilder) Offset(offset int) *SelectBuilder {
+	sb.offset = &offset
+	return sb
+}
+
+type binder struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+func (b *binder) write(s string) {
+	b.sql.WriteString(s)
+}
+
+func (b *binder) bind(p part) {
+	rest := p.sql
+	for _, arg := range p.args {
+		i := strings.IndexByte(rest, '?')
+		if i < 0 {
+			break
+		}
+
+		b.args = append(b.args, arg)
+		b.sql.WriteString(rest[:i])
+		b.sql.WriteString("$" + strconv.Itoa(len(b.args)))
+		rest = rest[i+1:]
+	}
+	b.sql.WriteString(rest)
+}
+
+func (b *binder) bindAll(parts []part, sep string) {
+	for i, p := range parts {
+		if i > 0 {
+			b.write(sep)
+		}
+		b.bind(p)
+	}
+}
+
+func (sb *SelectBuilder) writeFrom(b *binder) {
+	b.write(" from " + sb.from)
+	for _, join := range sb.joins {
+		b.write(" " + join)
+	}
+
+	if len(sb.where) != 0 {
+		b.write(" where ")
+		b.bindAll(sb.where, " and ")
+	}
+
+	if len(sb.groupBy) != 0 {
+		b.write(" group by " + strings.Join(sb.groupBy, ", "))
+	}
+}
+
+// Build returns the statement and its arguments in placeholder order.
+func (sb *SelectBuilder) Build() (string, []interface{}) {
+	b := &binder{args: []interface{}{}}
+
+	b.write("select " + sb.columns)
+	sb.writeFrom(b)
+
+	if len(sb.orderBy) != 0 {
+		b.write(" order by ")
+		b.bindAll(sb.orderBy, ", ")
+	}
+
+	if sb.limit != nil {
+		b.bind(part{" limit ?", []interface{}{*sb.limit}})
+	}
+	if sb.offset != nil {
+		b.bind(part{" offset ?", []interface{}{*sb.offset}})
+	}
+
+	return b.sql.String(), b.args
+}
+
+// BuildCount returns a statement counting the rows Build would return without
+// limit and offset.
+func (sb *SelectBuilder) BuildCount() (string, []interface{}) {
+	b := &binder{args: []interface{}{}}
+
+	if len(sb.groupBy) != 0 {
+		b.write("select count(*) from (select " + sb.columns)
+		sb.writeFrom(b)
+		b.write(") as counted")
+	} else {
+		b.write("select count(*)")
+		sb.writeFrom(b)
+	}
+
+	return b.sql.String(), b.args
+}
+
+// SortKey is one column of a keyset ordering.
+type SortKey struct {
+	Expr string
+	Desc bool
+}
+
+// OrderByKeys orders by the keys in turn.
+func (sb *SelectBuilder) OrderByKeys(keys ...SortKey) *SelectBuilder {
+	for _, key := range keys {
+		if key.Desc {
+			sb.OrderBy(key.Expr + " desc")
+		} else {
+			sb.OrderBy(key.Expr)
+		}
+	}
+
+	return sb
+}
+
+// After keeps only rows that come after the row with the given key values in
+// the keys ordering, which is how keyset pagination seeks to the next page.
+// Values that don`t match the keys add no condition, so callers check them
+// first.
+func (sb *SelectBuilder) After(keys []SortKey, values []interface{}) *SelectBuilder {
+	if len(keys) == 0 || len(keys) != len(values) {
+		return sb
+	}
+
+	alternatives := []string{}
+	args := []interface{}{}
+
+	for i, key := range keys {
+		conds := []string{}
+
+		for j := 0; j < i; j++ {
+			conds = append(conds, keys[j].Expr+" = ?")
+			args = append(args, values[j])
+		}
+
+		op := " > ?"
+		if key.Desc {
+			op = " < ?"
+		}
+		conds = append(conds, key.Expr+op)
+		args = append(args, values[i])
+
+		alternatives = append(alternatives, "("+strings.Join(conds, " and ")+")")
+	}
+
+	return sb.Where("("+strings.Join(alternatives, " or ")+")", args...)
+}
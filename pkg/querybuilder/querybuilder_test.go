@@ -0,0 +1,212 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SelectBuilder
+		sql     string
+		args    []interface{}
+	}{
+		{
+			name:    "plain select",
+			builder: Select("*").From("Item"),
+			sql:     "select * from Item",
+			args:    []interface{}{},
+		},
+		{
+			name: "conditions are joined with and",
+			builder: Select("i.*").From("Item i").
+				Where("i.brand_id = ?", 3).
+				Where("i.category = ?", "ботинки").
+				Where("i.sex = ?", "male"),
+			sql:  "select i.* from Item i where i.brand_id = $1 and i.category = $2 and i.sex = $3",
+			args: []interface{}{3, "ботинки", "male"},
+		},
+		{
+			name: "condition without arguments",
+			builder: Select("*").From("Item").
+				Where("is_available").
+				Where("price <= ?", 500),
+			sql:  "select * from Item where is_available and price <= $1",
+			args: []interface{}{500},
+		},
+		{
+			name: "values are never interpolated",
+			builder: Select("*").From("Item").
+				Where("category = ?", "'; drop table Item; --"),
+			sql:  "select * from Item where category = $1",
+			args: []interface{}{"'; drop table Item; --"},
+		},
+		{
+			name: "several placeholders in one condition",
+			builder: Select("*").From("Item").
+				Where("price between ? and ?", 100, 200),
+			sql:  "select * from Item where price between $1 and $2",
+			args: []interface{}{100, 200},
+		},
+		{
+			name: "where in",
+			builder: Select("*").From("Item").
+				WhereIn("size", []string{"S", "M"}),
+			sql:  "select * from Item where size = any($1)",
+			args: []interface{}{[]string{"S", "M"}},
+		},
+		{
+			name: "joins, order, limit and offset",
+			builder: Select("i.*").From("Item i").
+				Join("left join Brand b on b.id = i.brand_id").
+				Where("b.brand_name = ?", "Nike").
+				OrderBy("price desc").
+				OrderBy("i.id").
+				Limit(20).
+				Offset(40),
+			sql:  "select i.* from Item i left join Brand b on b.id = i.brand_id where b.brand_name = $1 order by price desc, i.id limit $2 offset $3",
+			args: []interface{}{"Nike", 20, 40},
+		},
+		{
+			name: "order arguments are numbered after where arguments",
+			builder: Select("*").From("Item").
+				OrderBy("ts_rank(v, to_tsquery(?)) desc", "боти").
+				Where("v @@ to_tsquery(?)", "боти").
+				Limit(10),
+			sql:  "select * from Item where v @@ to_tsquery($1) order by ts_rank(v, to_tsquery($2)) desc limit $3",
+			args: []interface{}{"боти", "боти", 10},
+		},
+		{
+			name: "group by",
+			builder: Select("category", "count(*)").From("Item").
+				Where("sex = ?", "female").
+				GroupBy("category").
+				OrderBy("count(*) desc"),
+			sql:  "select category, count(*) from Item where sex = $1 group by category order by count(*) desc",
+			args: []interface{}{"female"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.builder.Build()
+
+			if sql != tt.sql {
+				t.Errorf("sql:\n got %q\nwant %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args: got %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestBuildCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SelectBuilder
+		sql     string
+		args    []interface{}
+	}{
+		{
+			name: "order, limit and offset are dropped",
+			builder: Select("*").From("Ordering").
+				Where("user_id = ?", 7).
+				OrderBy("commit_date desc").
+				Limit(20).
+				Offset(20),
+			sql:  "select count(*) from Ordering where user_id = $1",
+			args: []interface{}{7},
+		},
+		{
+			name: "grouped rows are counted",
+			builder: Select("category").From("Item").
+				Where("price > ?", 100).
+				GroupBy("category"),
+			sql:  "select count(*) from (select category from Item where price > $1 group by category) as counted",
+			args: []interface{}{100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.builder.BuildCount()
+
+			if sql != tt.sql {
+				t.Errorf("sql:\n got %q\nwant %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args: got %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []SortKey
+		values []interface{}
+		sql    string
+		args   []interface{}
+	}{
+		{
+			name:   "single key",
+			keys:   []SortKey{{Expr: "id"}},
+			values: []interface{}{10},
+			sql:    "select * from Item where ((id > $1)) order by id limit $2",
+			args:   []interface{}{10, 21},
+		},
+		{
+			name:   "mixed directions",
+			keys:   []SortKey{{Expr: "price", Desc: true}, {Expr: "id"}},
+			values: []interface{}{1500, 42},
+			sql:    "select * from Item where ((price < $1) or (price = $2 and id > $3)) order by price desc, id limit $4",
+			args:   []interface{}{1500, 1500, 42, 21},
+		},
+		{
+			name:   "three keys",
+			keys:   []SortKey{{Expr: "rating", Desc: true}, {Expr: "review_count", Desc: true}, {Expr: "id"}},
+			values: []interface{}{4.5, 3, 7},
+			sql: "select * from Item where ((rating < $1) or (rating = $2 and review_count < $3) or " +
+				"(rating = $4 and review_count = $5 and id > $6)) order by rating desc, review_count desc, id limit $7",
+			args: []interface{}{4.5, 4.5, 3, 4.5, 3, 7, 21},
+		},
+		{
+			name:   "values not matching keys are ignored",
+			keys:   []SortKey{{Expr: "price"}, {Expr: "id"}},
+			values: []interface{}{1500},
+			sql:    "select * from Item order by price, id limit $1",
+			args:   []interface{}{21},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := Select("*").From("Item").
+				After(tt.keys, tt.values).
+				OrderByKeys(tt.keys...).
+				Limit(21).
+				Build()
+
+			if sql != tt.sql {
+				t.Errorf("sql:\n got %q\nwant %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args: got %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestBuildIsRepeatable(t *testing.T) {
+	builder := Select("*").From("Item").Where("price > ?", 1).Limit(5)
+
+	first, firstArgs := builder.Build()
+	second, secondArgs := builder.Build()
+
+	if first != second || !reflect.DeepEqual(firstArgs, secondArgs) {
+		t.Errorf("builds differ: %q %v and %q %v", first, firstArgs, second, secondArgs)
+	}
+}
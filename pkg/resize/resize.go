@@ -0,0 +1,111 @@
+// Package resize scales images down by area averaging: every destination
+// pixel is the mean of the source pixels it covers, which gives smooth
+// thumbnails without the aliasing of nearest-neighbour sampling.
+package resize
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Fit returns the size of a w×h image scaled down to fit a maxSide×maxSide
+// box, keeping the aspect ratio. Images that already fit are not enlarged.
+func Fit(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+
+	scale := float64(maxSide) / float64(max(w, h))
+
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// contrib is the run of source pixels one destination pixel covers and the
+// share of each of them.
+type contrib struct {
+	start   int
+	weights []float32
+}
+
+func contribs(srcLen, dstLen int) []contrib {
+	scale := float64(srcLen) / float64(dstLen)
+	cs := make([]contrib, dstLen)
+
+	for d := range cs {
+		lo := float64(d) * scale
+		hi := lo + scale
+
+		start := int(lo)
+		end := min(int(math.Ceil(hi)), srcLen)
+
+		weights := make([]float32, end-start)
+		for i := start; i < end; i++ {
+			overlap := math.Min(hi, float64(i+1)) - math.Max(lo, float64(i))
+			weights[i-start] = float32(overlap / scale)
+		}
+
+		cs[d] = contrib{start, weights}
+	}
+
+	return cs
+}
+
+func toByte(v float32) uint8 {
+	return uint8(min(max(v+0.5, 0), 255))
+}
+
+// Resize scales src to w×h. It is meant for shrinking; enlarging works but
+// gives blocky results.
+func Resize(src image.Image, w, h int) *image.RGBA {
+	bounds := src.Bounds()
+
+	rgba, ok := src.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// Horizontal pass into tmp, w×srcH. Averaging premultiplied RGBA keeps
+	// transparent pixels from bleeding their color into the result.
+	tmp := make([]float32, w*srcH*4)
+	for x, c := range contribs(srcW, w) {
+		for y := 0; y < srcH; y++ {
+			row := rgba.Pix[y*rgba.Stride:]
+			var r, g, b, a float32
+
+			for i, weight := range c.weights {
+				p := row[(c.start+i)*4:]
+				r += float32(p[0]) * weight
+				g += float32(p[1]) * weight
+				b += float32(p[2]) * weight
+				a += float32(p[3]) * weight
+			}
+
+			t := tmp[(y*w+x)*4:]
+			t[0], t[1], t[2], t[3] = r, g, b, a
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y, c := range contribs(srcH, h) {
+		for x := 0; x < w; x++ {
+			var r, g, b, a float32
+
+			for i, weight := range c.weights {
+				t := tmp[((c.start+i)*w+x)*4:]
+				r += t[0] * weight
+				g += t[1] * weight
+				b += t[2] * weight
+				a += t[3] * weight
+			}
+
+			p := dst.Pix[y*dst.Stride+x*4:]
+			p[0], p[1], p[2], p[3] = toByte(r), toByte(g), toByte(b), toByte(a)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,165 @@
+package resize
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name    string
+		w, h    int
+		maxSide int
+		wantW   int
+		wantH   int
+	}{
+		{
+			name: "landscape keeps aspect ratio",
+			w:    4000, h: 3000, maxSide: 1600,
+			wantW: 1600, wantH: 1200,
+		},
+		{
+			name: "portrait keeps aspect ratio",
+			w:    3000, h: 4000, maxSide: 480,
+			wantW: 360, wantH: 480,
+		},
+		{
+			name: "square",
+			w:    1000, h: 1000, maxSide: 160,
+			wantW: 160, wantH: 160,
+		},
+		{
+			name: "odd ratio is rounded",
+			w:    1000, h: 333, maxSide: 160,
+			wantW: 160, wantH: 53,
+		},
+		{
+			name: "one pixel high strip stays one pixel high",
+			w:    10000, h: 1, maxSide: 160,
+			wantW: 160, wantH: 1,
+		},
+		{
+			name: "one pixel wide strip stays one pixel wide",
+			w:    1, h: 10000, maxSide: 160,
+			wantW: 1, wantH: 160,
+		},
+		{
+			name: "thin strip doesn`t collapse to zero",
+			w:    5000, h: 2, maxSide: 160,
+			wantW: 160, wantH: 1,
+		},
+		{
+			name: "one pixel image",
+			w:    1, h: 1, maxSide: 160,
+			wantW: 1, wantH: 1,
+		},
+		{
+			name: "smaller image is not enlarged",
+			w:    100, h: 50, maxSide: 160,
+			wantW: 100, wantH: 50,
+		},
+		{
+			name: "image of the box size is kept",
+			w:    160, h: 120, maxSide: 160,
+			wantW: 160, wantH: 120,
+		},
+	}
+
+	for _, test := range tests {
+		w, h := Fit(test.w, test.h, test.maxSide)
+		if w != test.wantW || h != test.wantH {
+			t.Errorf("%s: Fit(%d, %d, %d) = %dx%d, want %dx%d",
+				test.name, test.w, test.h, test.maxSide, w, h, test.wantW, test.wantH)
+		}
+	}
+}
+
+func fill(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestResize(t *testing.T) {
+	red := color.RGBA{200, 10, 10, 255}
+
+	tests := []struct {
+		name  string
+		src   image.Image
+		w, h  int
+		color color.RGBA
+	}{
+		{
+			name: "solid color is kept",
+			src:  fill(40, 30, red),
+			w:    4, h: 3,
+			color: red,
+		},
+		{
+			name: "uneven scale keeps the color",
+			src:  fill(7, 5, red),
+			w:    3, h: 2,
+			color: red,
+		},
+		{
+			name: "one pixel high strip",
+			src:  fill(1000, 1, red),
+			w:    16, h: 1,
+			color: red,
+		},
+		{
+			name: "one pixel wide strip",
+			src:  fill(1, 1000, red),
+			w:    1, h: 16,
+			color: red,
+		},
+		{
+			name: "source not at the origin",
+			src:  fill(20, 20, red).SubImage(image.Rect(5, 5, 15, 15)),
+			w:    5, h: 5,
+			color: red,
+		},
+		{
+			name: "transparency is kept",
+			src:  fill(10, 10, color.RGBA{}),
+			w:    2, h: 2,
+			color: color.RGBA{},
+		},
+	}
+
+	for _, test := range tests {
+		dst := Resize(test.src, test.w, test.h)
+
+		if dst.Bounds() != image.Rect(0, 0, test.w, test.h) {
+			t.Errorf("%s: bounds %v, want %dx%d", test.name, dst.Bounds(), test.w, test.h)
+			continue
+		}
+
+		for y := 0; y < test.h; y++ {
+			for x := 0; x < test.w; x++ {
+				if got := dst.RGBAAt(x, y); got != test.color {
+					t.Errorf("%s: pixel (%d, %d) is %v, want %v", test.name, x, y, got, test.color)
+				}
+			}
+		}
+	}
+}
+
+func TestResizeAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255})
+	src.SetRGBA(1, 0, color.RGBA{200, 100, 50, 255})
+
+	got := Resize(src, 1, 1).RGBAAt(0, 0)
+	want := color.RGBA{100, 50, 25, 255}
+
+	if got != want {
+		t.Errorf("averaged pixel is %v, want %v", got, want)
+	}
+}
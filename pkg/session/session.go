@@ -19,6 +19,11 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
+type GuestClaims struct {
+	BasketID int `json:"basket_id"`
+	jwt.StandardClaims
+}
+
 type JWTSessionsManager struct{}
 
 func (jsm JWTSessionsManager) GetUser(inToken string) (int, string, error) {
@@ -68,3 +73,46 @@ func (jsm JWTSessionsManager) CreateSession(id int, role string) (string, error)
 
 	return tokenString, nil
 }
+
+func (jsm JWTSessionsManager) GetGuestBasket(inToken string) (int, error) {
+	token, err := jwt.ParseWithClaims(inToken, &GuestClaims{}, func(token *jwt.Token) (interface{}, error) {
+		method, ok := token.Method.(*jwt.SigningMethodHMAC)
+		if !ok || method.Alg() != "HS256" {
+			return nil, errors.Errorf("bad sign method guest token, expected: \"HS256\", got: \"%s\"", token.Method.Alg())
+		}
+		return tokenKey, nil
+	})
+
+	if err != nil {
+		return -1, errors.Wrapf(err, "can`t parse guest token \"%s\"", inToken)
+	}
+	if !token.Valid {
+		return -1, errors.Errorf("guest token \"%s\" isn`t valid", inToken)
+	}
+
+	claims, ok := token.Claims.(*GuestClaims)
+	if !ok || claims.BasketID <= 0 {
+		return -1, errors.Errorf("can`t parse guest token \"%s\"", inToken)
+	}
+
+	return claims.BasketID, nil
+}
+
+func (jsm JWTSessionsManager) CreateGuestSession(basketID int) (string, error) {
+	claims := GuestClaims{
+		basketID,
+		jwt.StandardClaims{
+			ExpiresAt: time.Now().AddDate(0, 1, 0).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString(tokenKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to convert token to string")
+	}
+
+	return tokenString, nil
+}
@@ -18,6 +18,32 @@ ORDER_ITEMS_ROWS = 50000
 myFaker = faker.Faker("en_US")
 myRuFaker = faker.Faker("ru_RU")
 
+# Item titles are an adjective agreeing with the category, which is plural,
+# feminine or masculine, followed by the category.
+TITLE_ADJECTIVES = {
+    "plural": ["Летние", "Зимние", "Лёгкие", "Хлопковые", "Тёплые", "Спортивные", "Классические", "Базовые",
+               "Повседневные", "Кожаные"],
+    "feminine": ["Летняя", "Зимняя", "Лёгкая", "Хлопковая", "Тёплая", "Спортивная", "Классическая", "Базовая",
+                 "Повседневная", "Кожаная"],
+    "masculine": ["Летний", "Зимний", "Лёгкий", "Хлопковый", "Тёплый", "Спортивный", "Классический", "Базовый",
+                  "Повседневный", "Кожаный"],
+}
+
+CATEGORY_FORMS = {
+    "ботинки": "plural", "кроссовки": "plural", "штаны": "plural", "шорты": "plural",
+    "майка": "feminine", "футболка": "feminine", "куртка": "feminine", "шляпа": "feminine",
+    "ремень": "masculine",
+}
+
+DESCRIPTIONS = [
+    "Удобная модель на каждый день.",
+    "Лаконичный дизайн без лишних деталей.",
+    "Натуральные материалы и аккуратные швы.",
+    "Подходит для спорта и прогулок.",
+    "Прочная фурнитура, долго служит.",
+    "Свободный крой, приятная к телу ткань.",
+]
+
 def generateUser():
     sex = ["male", "female"]
     file = open(userFile, "w", encoding="utf-8")
@@ -55,8 +81,15 @@ def generateItem():
     boolean = ["true", "false"]
 
     for i in range(ITEM_ROWS):
-        line = "{};{};{};{};{};{};{};{}\n".format(i + 1, choice(category), choice(size), randint(100, 20000), 
-                                            choice(sex), myFaker.iana_id(), randint(1, BRAND_ROWS), choice(boolean))
+        isAvailable = choice(boolean)
+        stock = randint(1, 20) if isAvailable == "true" else 0
+
+        curCategory = choice(category)
+        title = "{} {}".format(choice(TITLE_ADJECTIVES[CATEGORY_FORMS[curCategory]]), curCategory)
+
+        line = "{};{};{};{};{};{};{};{};{};{};{}\n".format(i + 1, curCategory, choice(size), randint(100, 20000), 
+                                            choice(sex), myFaker.iana_id(), randint(1, BRAND_ROWS), isAvailable, stock,
+                                            title, choice(DESCRIPTIONS))
 
         file.write(line)
 